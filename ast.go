@@ -1,83 +1,763 @@
 package main
 
 import (
-  "fmt"
-  // "time"
-  // "os"
-  // "strconv"
+	"fmt"
+	"reflect"
+	"strings"
 )
 
-type AstTree struct {
-    key string
-    level int
-    typ  itemType
-    data  string
-    text string
-    parent  *AstTree
-    childs []*AstTree
+// Node is implemented by every node of the syntax tree.
+type Node interface {
+	Pos() Pos   // offset of the first byte of the node
+	End() Pos   // offset just past the last byte of the node
+	ID() NodeID // identity of the node within its tree, see NodeID
+	setID(id NodeID)
 }
 
-func indexOfInSlice(a []*AstTree, b AstTree) int {
-    for i, n := range a {
-        if b.key == n.key {
-          return i
-        }
-    }
+// Expr is implemented by expressions and by type expressions.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Stmt is implemented by statements.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Decl is implemented by top level declarations.
+type Decl interface {
+	Node
+	declNode()
+}
+
+// declStmt is implemented by the declarations that may also appear as
+// statements inside functions.
+type declStmt interface {
+	Decl
+	stmtNode()
+}
+
+// NodeID identifies a node within the tree of one file. IDs are handed out
+// by the idAllocator of the file in depth-first order, so the same source
+// always gets the same IDs. The zero NodeID means not numbered yet.
+type NodeID int
+
+// span holds the source range and the identity shared by all nodes.
+type span struct {
+	pos Pos
+	end Pos
+	id  NodeID
+}
+
+func (s *span) Pos() Pos {
+	return s.pos
+}
+
+func (s *span) End() Pos {
+	return s.end
+}
+
+func (s *span) ID() NodeID {
+	return s.id
+}
+
+func (s *span) setID(id NodeID) {
+	s.id = id
+}
+
+// idAllocator numbers the nodes of one tree.
+type idAllocator struct {
+	last NodeID
+}
+
+// number gives an ID to every node under root that does not have one yet,
+// in depth-first order.
+func (a *idAllocator) number(root Node) {
+	Inspect(root, func(node Node) bool {
+		if node.ID() == 0 {
+			a.last++
+			node.setID(a.last)
+		}
+
+		return true
+	})
+}
+
+type (
+	// File is the root of the tree of one source file.
+	File struct {
+		span
+		Package *Ident
+		Imports []*ImportSpec
+		Decls   []Decl
+
+		// Methods holds the method declarations of the file by the name
+		// of their receiver base type, in source order.
+		Methods map[string][]*FuncDecl
+
+		ids idAllocator
+	}
+
+	// ImportSpec is one imported package. Name is nil unless the import
+	// has an alias, "." or "_".
+	ImportSpec struct {
+		span
+		Name *Ident
+		Path *BasicLit
+	}
+
+	// FuncDecl is a function or method declaration. Recv is nil for
+	// functions.
+	FuncDecl struct {
+		span
+		Recv    *Field
+		Name    *Ident
+		Params  []*Field
+		Results []*Field
+		Body    *BlockStmt
+	}
+
+	// Field is a group of parameters, results or struct fields sharing a
+	// type. Names is empty when they are unnamed, or for an embedded field.
+	// Tag is only set for struct fields with a tag.
+	Field struct {
+		span
+		Names []*Ident
+		Type  Expr
+		Tag   *BasicLit
+	}
+
+	// TypeDecl is a type declaration, an alias declaration when Alias is
+	// set. It is a statement inside functions.
+	TypeDecl struct {
+		span
+		Name  *Ident
+		Alias bool
+		Type  Expr
+	}
+
+	// BadDecl marks a declaration that could not be parsed.
+	BadDecl struct {
+		span
+	}
+)
+
+type (
+	// BlockStmt is a braced statement list.
+	BlockStmt struct {
+		span
+		List []Stmt
+	}
+
+	// VarDecl is a var declaration. It is a statement inside functions.
+	VarDecl struct {
+		span
+		Names  []*Ident
+		Type   Expr // nil when the type is inferred
+		Values []Expr
+	}
+
+	// ConstDecl is a const declaration. Inside a group, Values is empty
+	// when the declaration repeats the type and the values of the one
+	// before it. Iota is its index in the group and Constants holds the
+	// value of every name, nil where it is not known.
+	ConstDecl struct {
+		span
+		Names     []*Ident
+		Type      Expr
+		Values    []Expr
+		Iota      int
+		Constants []*Constant
+	}
+
+	// DeclGroup is a parenthesized group of declarations. Tok is itemConst,
+	// itemVar or itemTypeDefine.
+	DeclGroup struct {
+		span
+		Tok   itemType
+		Decls []Decl
+	}
+
+	// AssignStmt assigns the values of Rhs to Lhs. For a short variable
+	// declaration Tok is itemDeclare and Declared holds the names of Lhs
+	// that it declares, the others are only assigned to.
+	AssignStmt struct {
+		span
+		Lhs      []Expr
+		Tok      itemType // itemAssign or itemDeclare
+		Rhs      []Expr
+		Declared []*Ident
+	}
+
+	// IncDecStmt is X++ or X--.
+	IncDecStmt struct {
+		span
+		X   Expr
+		Tok itemType // itemDoublePlus or itemDoubleMinus
+	}
+
+	// ExprStmt is an expression used as a statement, usually a call.
+	ExprStmt struct {
+		span
+		X Expr
+	}
+
+	// ReturnStmt is a return statement.
+	ReturnStmt struct {
+		span
+		Results []Expr
+	}
+
+	// DeferStmt is the statement defer Call.
+	DeferStmt struct {
+		span
+		Call *CallExpr
+	}
+
+	// IfStmt is an if statement. Init is nil when there is no init
+	// statement. Else is nil, a *BlockStmt or the *IfStmt of an else-if.
+	IfStmt struct {
+		span
+		Init Stmt
+		Cond Expr
+		Body *BlockStmt
+		Else Stmt
+	}
+
+	// ForStmt is a for statement. Init, Cond and Post are nil when they
+	// are left out.
+	ForStmt struct {
+		span
+		Init Stmt
+		Cond Expr
+		Post Stmt
+		Body *BlockStmt
+	}
+
+	// RangeStmt is a for statement with a range clause. Key and Value are
+	// nil when they are left out, Tok is itemDeclare when they are declared
+	// by the loop and itemAssign otherwise.
+	RangeStmt struct {
+		span
+		Key   Expr
+		Value Expr
+		Tok   itemType
+		X     Expr
+		Body  *BlockStmt
+	}
+
+	// SwitchStmt is an expression switch. Init and Tag are nil when they
+	// are left out. The list of Body holds *CaseClause statements only.
+	SwitchStmt struct {
+		span
+		Init Stmt
+		Tag  Expr
+		Body *BlockStmt
+	}
+
+	// TypeSwitchStmt is a type switch. Assign is either x.(type) as an
+	// *ExprStmt or v := x.(type) as an *AssignStmt.
+	TypeSwitchStmt struct {
+		span
+		Init   Stmt
+		Assign Stmt
+		Body   *BlockStmt
+	}
+
+	// CaseClause is a case of a switch, or its default when List is nil.
+	CaseClause struct {
+		span
+		List []Expr
+		Body []Stmt
+	}
+
+	// BranchStmt is a break, continue, goto or fallthrough statement.
+	// Label is nil when there is no label.
+	BranchStmt struct {
+		span
+		Tok   itemType
+		Label *Ident
+	}
+
+	// LabeledStmt is a statement with a label.
+	LabeledStmt struct {
+		span
+		Label *Ident
+		Stmt  Stmt
+	}
+
+	// EmptyStmt is the statement labeled by a label at the end of a block.
+	EmptyStmt struct {
+		span
+	}
 
-    return -1
+	// BadStmt marks a statement that could not be parsed.
+	BadStmt struct {
+		span
+	}
+)
+
+type (
+	// Ident is an identifier.
+	Ident struct {
+		span
+		Name string
+	}
+
+	// BasicLit is a number, string or rune literal. Value is the decoded
+	// value carried by the token, nil if the literal is malformed.
+	BasicLit struct {
+		span
+		Kind  itemType // itemNumber, itemString, itemRawString or itemCharConstant
+		Text  string
+		Value interface{}
+	}
+
+	// CompositeLit is a composite literal. Type is nil for the elements of
+	// an enclosing literal that leave it out.
+	CompositeLit struct {
+		span
+		Type Expr
+		Elts []Expr
+	}
+
+	// UnaryExpr applies a prefix operator to X.
+	UnaryExpr struct {
+		span
+		Op itemType
+		X  Expr
+	}
+
+	// BinaryExpr is X Op Y.
+	BinaryExpr struct {
+		span
+		X  Expr
+		Op itemType
+		Y  Expr
+	}
+
+	// CallExpr calls Fun with Args. Ellipsis is the position of the ... that
+	// spreads the last argument over a variadic parameter, or 0.
+	CallExpr struct {
+		span
+		Fun      Expr
+		Args     []Expr
+		Ellipsis Pos
+	}
+
+	// IndexExpr is X[Index].
+	IndexExpr struct {
+		span
+		X     Expr
+		Index Expr
+	}
+
+	// SelectorExpr is X.Sel.
+	SelectorExpr struct {
+		span
+		X   Expr
+		Sel *Ident
+	}
+
+	// ArrayType is [Len]Elt. Len is nil for the slice type []Elt and an
+	// *Ellipsis for [...]Elt.
+	ArrayType struct {
+		span
+		Len Expr
+		Elt Expr
+	}
+
+	// Ellipsis is the type ...Elt of a variadic parameter, or the length
+	// of [...]T without Elt.
+	Ellipsis struct {
+		span
+		Elt Expr
+	}
+
+	// TypeAssertExpr is X.(Type). Type is nil for the X.(type) of a type
+	// switch.
+	TypeAssertExpr struct {
+		span
+		X    Expr
+		Type Expr
+	}
+
+	// KeyValueExpr is an element of a composite literal with its key.
+	KeyValueExpr struct {
+		span
+		Key   Expr
+		Value Expr
+	}
+
+	// StructType is struct { Fields }.
+	StructType struct {
+		span
+		Fields []*Field
+	}
+
+	// InterfaceType is interface { Methods }. A method has a name and a
+	// FuncType. The other elements are embedded interfaces and, in
+	// constraints, unions of type terms: a BinaryExpr with itemPipe joins
+	// the terms and a UnaryExpr with itemTilde is a ~T term.
+	InterfaceType struct {
+		span
+		Methods []*Field
+	}
+
+	// MapType is map[Key]Value.
+	MapType struct {
+		span
+		Key   Expr
+		Value Expr
+	}
+
+	// StarExpr is *X, a pointer type or a pointer indirection.
+	StarExpr struct {
+		span
+		X Expr
+	}
+
+	// SliceExpr is X[Low:High] or, when Slice3 is set, X[Low:High:Max].
+	// Left out indexes are nil.
+	SliceExpr struct {
+		span
+		X      Expr
+		Low    Expr
+		High   Expr
+		Max    Expr
+		Slice3 bool
+	}
+
+	// FuncType is the type of a function, func(Params) Results.
+	FuncType struct {
+		span
+		Params  []*Field
+		Results []*Field
+	}
+
+	// FuncLit is a function literal. Free holds the declarations of the
+	// variables of enclosing functions that the body uses, in the order of
+	// their first use. A closure shares them with the functions that
+	// declare them; they are not children of the literal.
+	FuncLit struct {
+		span
+		Type *FuncType
+		Body *BlockStmt
+		Free []*Ident
+	}
+
+	// BadExpr marks an expression that could not be parsed.
+	BadExpr struct {
+		span
+	}
+)
+
+func (*FuncDecl) declNode()  {}
+func (*VarDecl) declNode()   {}
+func (*ConstDecl) declNode() {}
+func (*DeclGroup) declNode() {}
+func (*TypeDecl) declNode()  {}
+func (*BadDecl) declNode()   {}
+
+func (*BlockStmt) stmtNode()      {}
+func (*VarDecl) stmtNode()        {}
+func (*ConstDecl) stmtNode()      {}
+func (*DeclGroup) stmtNode()      {}
+func (*TypeDecl) stmtNode()       {}
+func (*AssignStmt) stmtNode()     {}
+func (*IncDecStmt) stmtNode()     {}
+func (*ExprStmt) stmtNode()       {}
+func (*ReturnStmt) stmtNode()     {}
+func (*DeferStmt) stmtNode()      {}
+func (*IfStmt) stmtNode()         {}
+func (*ForStmt) stmtNode()        {}
+func (*RangeStmt) stmtNode()      {}
+func (*SwitchStmt) stmtNode()     {}
+func (*TypeSwitchStmt) stmtNode() {}
+func (*CaseClause) stmtNode()     {}
+func (*BranchStmt) stmtNode()     {}
+func (*LabeledStmt) stmtNode()    {}
+func (*EmptyStmt) stmtNode()      {}
+func (*BadStmt) stmtNode()        {}
+
+func (*Ident) exprNode()          {}
+func (*BasicLit) exprNode()       {}
+func (*CompositeLit) exprNode()   {}
+func (*UnaryExpr) exprNode()      {}
+func (*BinaryExpr) exprNode()     {}
+func (*CallExpr) exprNode()       {}
+func (*IndexExpr) exprNode()      {}
+func (*SelectorExpr) exprNode()   {}
+func (*ArrayType) exprNode()      {}
+func (*Ellipsis) exprNode()       {}
+func (*TypeAssertExpr) exprNode() {}
+func (*KeyValueExpr) exprNode()   {}
+func (*StructType) exprNode()     {}
+func (*InterfaceType) exprNode()  {}
+func (*MapType) exprNode()        {}
+func (*StarExpr) exprNode()       {}
+func (*SliceExpr) exprNode()      {}
+func (*FuncType) exprNode()       {}
+func (*FuncLit) exprNode()        {}
+func (*BadExpr) exprNode()        {}
+
+// capture records the variable declared by declaration as free in f.
+func (f *FuncLit) capture(declaration *Ident) {
+	for _, free := range f.Free {
+		if free == declaration {
+			return
+		}
+	}
+
+	f.Free = append(f.Free, declaration)
 }
 
-func removeFromSlice(slice []*AstTree, s int) []*AstTree {
-    return append(slice[:s], slice[s+1:]...)
+// children returns the direct children of node in source order.
+func children(node Node) []Node {
+	var list []Node
+
+	add := func(nodes ...Node) {
+		for _, n := range nodes {
+			if n != nil && !isNilNode(n) {
+				list = append(list, n)
+			}
+		}
+	}
+
+	switch n := node.(type) {
+	case *File:
+		add(n.Package)
+
+		for _, spec := range n.Imports {
+			add(spec)
+		}
+
+		for _, decl := range n.Decls {
+			add(decl)
+		}
+	case *ImportSpec:
+		add(n.Name, n.Path)
+	case *FuncDecl:
+		add(n.Recv, n.Name)
+
+		for _, field := range n.Params {
+			add(field)
+		}
+
+		for _, field := range n.Results {
+			add(field)
+		}
+
+		add(n.Body)
+	case *Field:
+		for _, name := range n.Names {
+			add(name)
+		}
+
+		add(n.Type, n.Tag)
+	case *TypeDecl:
+		add(n.Name, n.Type)
+	case *BlockStmt:
+		for _, stmt := range n.List {
+			add(stmt)
+		}
+	case *VarDecl:
+		for _, name := range n.Names {
+			add(name)
+		}
+
+		add(n.Type)
+		add(exprNodes(n.Values)...)
+	case *ConstDecl:
+		for _, name := range n.Names {
+			add(name)
+		}
+
+		add(n.Type)
+		add(exprNodes(n.Values)...)
+	case *DeclGroup:
+		for _, decl := range n.Decls {
+			add(decl)
+		}
+	case *AssignStmt:
+		add(exprNodes(n.Lhs)...)
+		add(exprNodes(n.Rhs)...)
+	case *IncDecStmt:
+		add(n.X)
+	case *ExprStmt:
+		add(n.X)
+	case *ReturnStmt:
+		add(exprNodes(n.Results)...)
+	case *DeferStmt:
+		add(n.Call)
+	case *IfStmt:
+		add(n.Init, n.Cond, n.Body, n.Else)
+	case *ForStmt:
+		add(n.Init, n.Cond, n.Post, n.Body)
+	case *RangeStmt:
+		add(n.Key, n.Value, n.X, n.Body)
+	case *SwitchStmt:
+		add(n.Init, n.Tag, n.Body)
+	case *TypeSwitchStmt:
+		add(n.Init, n.Assign, n.Body)
+	case *CaseClause:
+		add(exprNodes(n.List)...)
+
+		for _, stmt := range n.Body {
+			add(stmt)
+		}
+	case *BranchStmt:
+		add(n.Label)
+	case *LabeledStmt:
+		add(n.Label, n.Stmt)
+	case *CompositeLit:
+		add(n.Type)
+		add(exprNodes(n.Elts)...)
+	case *UnaryExpr:
+		add(n.X)
+	case *BinaryExpr:
+		add(n.X, n.Y)
+	case *CallExpr:
+		add(n.Fun)
+		add(exprNodes(n.Args)...)
+	case *IndexExpr:
+		add(n.X, n.Index)
+	case *SelectorExpr:
+		add(n.X, n.Sel)
+	case *ArrayType:
+		add(n.Len, n.Elt)
+	case *Ellipsis:
+		add(n.Elt)
+	case *TypeAssertExpr:
+		add(n.X, n.Type)
+	case *KeyValueExpr:
+		add(n.Key, n.Value)
+	case *MapType:
+		add(n.Key, n.Value)
+	case *StarExpr:
+		add(n.X)
+	case *SliceExpr:
+		add(n.X, n.Low, n.High, n.Max)
+	case *StructType:
+		for _, field := range n.Fields {
+			add(field)
+		}
+	case *InterfaceType:
+		for _, field := range n.Methods {
+			add(field)
+		}
+	case *FuncType:
+		for _, field := range n.Params {
+			add(field)
+		}
+
+		for _, field := range n.Results {
+			add(field)
+		}
+	case *FuncLit:
+		add(n.Type, n.Body)
+	}
+
+	return list
+}
+
+func exprNodes(exprs []Expr) []Node {
+	nodes := make([]Node, len(exprs))
+
+	for i, expr := range exprs {
+		nodes[i] = expr
+	}
+
+	return nodes
 }
 
-func (tree *AstTree) addChild(child *AstTree) *AstTree {
-  if (child.parent != nil) {
-    if indexOfInSlice(child.parent.childs, *child) != -1 {
-      child.parent.childs = removeFromSlice(child.parent.childs, indexOfInSlice(child.parent.childs, *child))
-    }
-  }
+// isNilNode reports whether node is an interface holding a nil pointer, as
+// left behind by optional children such as FuncDecl.Body.
+func isNilNode(node Node) bool {
+	value := reflect.ValueOf(node)
 
-  if indexOfInSlice(tree.childs, *child) != -1 {
-    tree.childs = removeFromSlice(tree.childs, indexOfInSlice(tree.childs, *child))
-  }
+	return value.Kind() == reflect.Ptr && value.IsNil()
+}
+
+// Inspect walks the tree rooted at node in depth-first order. f is called
+// for every node and the children are skipped when it returns false.
+func Inspect(node Node, f func(Node) bool) {
+	if !f(node) {
+		return
+	}
 
-  tree.childs = append(tree.childs, child)
-  child.parent = tree
+	for _, child := range children(node) {
+		Inspect(child, f)
+	}
+}
 
-  return child
+// nodeName is the name of the concrete type of node, e.g. "IfStmt".
+func nodeName(node Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*main.")
 }
 
-func (tree *AstTree) removeChild(child AstTree) {
-  if indexOfInSlice(tree.childs, child) != -1 {
-    tree.childs = removeFromSlice(tree.childs, indexOfInSlice(tree.childs, child))
+// nodeValue is the text printed next to the leaves of the tree.
+func nodeValue(node Node) string {
+	switch n := node.(type) {
+	case *Ident:
+		return n.Name
+	case *BasicLit:
+		return n.Text
+	case *UnaryExpr:
+		return operatorSpelling(n.Op)
+	case *BinaryExpr:
+		return operatorSpelling(n.Op)
+	case *AssignStmt:
+		return operatorSpelling(n.Tok)
+	case *IncDecStmt:
+		return operatorSpelling(n.Tok)
+	case *BranchStmt:
+		return valuesTranslations[n.Tok]
+	case *DeclGroup:
+		for word, typ := range keyWords {
+			if typ == n.Tok {
+				return word
+			}
+		}
+	case *RangeStmt:
+		if n.Key != nil {
+			return operatorSpelling(n.Tok)
+		}
+	}
 
-    if child.parent == tree {
-      child.parent = nil
-    }
-  }
+	return ""
 }
 
-func printTree(tree *AstTree) {
-  if tree.typ == -1 {
-    fmt.Println("[ Abstract syntax tree ]")
-  }
+// operatorSpelling returns the source form of an operator item type.
+func operatorSpelling(typ itemType) string {
+	for spelling, t := range operators {
+		if t == typ {
+			return spelling
+		}
+	}
 
-  for index := 0; index < tree.level; index++ {
-    fmt.Print("-")
-  }
+	return valuesTranslations[typ]
+}
+
+func printTree(tree *File) {
+	fmt.Println("[ Abstract syntax tree ]")
+	printNode(tree, 0)
+}
 
-  if tree.typ != -1 {
-    fmt.Print(">")
+func printNode(node Node, level int) {
+	if level > 0 {
+		fmt.Print(strings.Repeat("-", level * 2 - 1))
 
-    if tree.typ == itemNode {
-      fmt.Println("[ Type:", tree.text, "]")
-    } else {
-        fmt.Println("[ Type:", tree.text, ", value: '", tree.data, "' ] ")
-    }
-  }
+		if value := nodeValue(node); value != "" {
+			fmt.Println(">[ Id:", node.ID(), ", Type:", nodeName(node), ", value: '", value, "' ] ")
+		} else {
+			fmt.Println(">[ Id:", node.ID(), ", Type:", nodeName(node), "]")
+		}
+	}
 
-  for _, child := range tree.childs {
-      printTree(child)
-  }
+	for _, child := range children(node) {
+		printNode(child, level + 1)
+	}
 }
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// constantKind is the class of a constant value. Untyped constants of each
+// kind default to bool, string, int, rune, float64 and complex128.
+type constantKind int
+
+const (
+	constantBool constantKind = iota + 1
+	constantString
+	constantInt
+	constantRune
+	constantFloat
+	constantComplex
+)
+
+// Constant is the exact value of a constant expression. Type names the type
+// of a typed constant and is empty for untyped ones. Value is a bool, a
+// string, a *big.Int for integers and runes, a *big.Float or a
+// complexValue.
+type Constant struct {
+	Kind  constantKind
+	Type  string
+	Value interface{}
+
+	basic *basicType // the predeclared type Type is based on, if known
+}
+
+type complexValue struct {
+	re, im *big.Float
+}
+
+// basicType describes a predeclared type a constant can have. bits is the
+// size of sized numeric types.
+type basicType struct {
+	kind     constantKind
+	bits     int
+	unsigned bool
+}
+
+var basicTypes = map[string]basicType{
+	"bool":       {constantBool, 0, false},
+	"string":     {constantString, 0, false},
+	"int":        {constantInt, 64, false},
+	"int8":       {constantInt, 8, false},
+	"int16":      {constantInt, 16, false},
+	"int32":      {constantInt, 32, false},
+	"rune":       {constantInt, 32, false},
+	"int64":      {constantInt, 64, false},
+	"uint":       {constantInt, 64, true},
+	"uint8":      {constantInt, 8, true},
+	"byte":       {constantInt, 8, true},
+	"uint16":     {constantInt, 16, true},
+	"uint32":     {constantInt, 32, true},
+	"uint64":     {constantInt, 64, true},
+	"uintptr":    {constantInt, 64, true},
+	"float32":    {constantFloat, 32, false},
+	"float64":    {constantFloat, 64, false},
+	"complex64":  {constantComplex, 64, false},
+	"complex128": {constantComplex, 128, false},
+}
+
+// maxShift bounds the count of a constant shift.
+const maxShift = 10000
+
+func (c *Constant) String() string {
+	switch value := c.Value.(type) {
+	case bool:
+		return strconv.FormatBool(value)
+	case string:
+		return strconv.Quote(value)
+	case *big.Int:
+		return value.String()
+	case *big.Float:
+		return value.Text('g', -1)
+	case complexValue:
+		return fmt.Sprintf("(%s + %si)", value.re.Text('g', -1), value.im.Text('g', -1))
+	}
+
+	return "?"
+}
+
+// describe spells c for messages, with its type, as in 1 (untyped int
+// constant) or 3 (constant of type uint8).
+func (c *Constant) describe() string {
+	if c.Type != "" {
+		return fmt.Sprintf("%s (constant of type %s)", c, c.Type)
+	}
+
+	names := map[constantKind]string{
+		constantBool:    "bool",
+		constantString:  "string",
+		constantInt:     "int",
+		constantRune:    "rune",
+		constantFloat:   "float",
+		constantComplex: "complex",
+	}
+
+	return fmt.Sprintf("%s (untyped %s constant)", c, names[c.Kind])
+}
+
+// literalConstant returns the untyped constant of a literal, or nil for a
+// malformed one.
+func literalConstant(literal *BasicLit) *Constant {
+	switch value := literal.Value.(type) {
+	case *big.Int:
+		return &Constant{Kind: constantInt, Value: value}
+	case *big.Float:
+		return &Constant{Kind: constantFloat, Value: value}
+	case imaginary:
+		return &Constant{Kind: constantComplex, Value: complexValue{newFloat(), value.im}}
+	case string:
+		return &Constant{Kind: constantString, Value: value}
+	case rune:
+		return &Constant{Kind: constantRune, Value: big.NewInt(int64(value))}
+	}
+
+	return nil
+}
+
+func boolConstant(value bool) *Constant {
+	return &Constant{Kind: constantBool, Value: value}
+}
+
+func newFloat() *big.Float {
+	return new(big.Float).SetPrec(floatPrecision)
+}
+
+// toKind returns the value of c as one of the numeric kind, which must not
+// be below the kind of c.
+func toKind(c *Constant, kind constantKind) interface{} {
+	switch value := c.Value.(type) {
+	case *big.Int:
+		switch kind {
+		case constantFloat:
+			return newFloat().SetInt(value)
+		case constantComplex:
+			return complexValue{newFloat().SetInt(value), newFloat()}
+		}
+	case *big.Float:
+		if kind == constantComplex {
+			return complexValue{value, newFloat()}
+		}
+	}
+
+	return c.Value
+}
+
+func isNumeric(kind constantKind) bool {
+	return kind >= constantInt
+}
+
+// convertConstant gives c the type name, based on the predeclared type
+// basic, or on an unknown one when basic is nil. A conversion, as in T(c),
+// also turns integers into strings.
+func convertConstant(c *Constant, name string, basic *basicType, conversion bool) (*Constant, error) {
+	if basic == nil {
+		return &Constant{Kind: c.Kind, Type: name, Value: c.Value}, nil
+	}
+
+	if conversion && basic.kind == constantString && (c.Kind == constantInt || c.Kind == constantRune) {
+		code := c.Value.(*big.Int)
+		r := '�'
+
+		if code.IsInt64() && code.Int64() >= 0 && code.Int64() <= 0x10FFFF {
+			r = rune(code.Int64())
+		}
+
+		return &Constant{Kind: constantString, Type: name, Value: string(r), basic: basic}, nil
+	}
+
+	mismatch := fmt.Errorf("cannot convert %s to type %s", c.describe(), name)
+
+	if isNumeric(basic.kind) != isNumeric(c.Kind) || !isNumeric(c.Kind) && basic.kind != c.Kind {
+		return nil, mismatch
+	}
+
+	converted := &Constant{Kind: basic.kind, Type: name, Value: c.Value, basic: basic}
+
+	switch basic.kind {
+	case constantInt:
+		value, err := integerValue(c)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !fitsInteger(value, basic) {
+			return nil, fmt.Errorf("constant %s overflows %s", value, name)
+		}
+
+		converted.Value = value
+	case constantFloat:
+		if value, ok := c.Value.(complexValue); ok {
+			if value.im.Sign() != 0 {
+				return nil, fmt.Errorf("constant %s truncated to real", c)
+			}
+
+			converted.Value = value.re
+		} else {
+			converted.Value = toKind(c, constantFloat)
+		}
+	case constantComplex:
+		converted.Value = toKind(c, constantComplex)
+	}
+
+	return converted, nil
+}
+
+// integerValue returns the value of a numeric constant as an integer. It
+// fails when the value has a fractional or an imaginary part.
+func integerValue(c *Constant) (*big.Int, error) {
+	value := c.Value
+
+	if number, ok := value.(complexValue); ok {
+		if number.im.Sign() != 0 {
+			return nil, fmt.Errorf("constant %s truncated to integer", c)
+		}
+
+		value = number.re
+	}
+
+	switch value := value.(type) {
+	case *big.Int:
+		return value, nil
+	case *big.Float:
+		if !value.IsInt() {
+			return nil, fmt.Errorf("constant %s truncated to integer", c)
+		}
+
+		integer, _ := value.Int(nil)
+
+		return integer, nil
+	}
+
+	return nil, fmt.Errorf("%s is not an integer", c.describe())
+}
+
+func fitsInteger(value *big.Int, basic *basicType) bool {
+	if basic.unsigned {
+		return value.Sign() >= 0 && value.BitLen() <= basic.bits
+	}
+
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(basic.bits - 1))
+
+	return value.Cmp(new(big.Int).Neg(limit)) >= 0 && value.Cmp(limit) < 0
+}
+
+// checkTyped reports a typed integer result that is out of the range of its
+// type.
+func checkTyped(c *Constant) (*Constant, error) {
+	if basic := c.basic; basic != nil && basic.kind == constantInt {
+		if value := c.Value.(*big.Int); !fitsInteger(value, basic) {
+			return nil, fmt.Errorf("constant %s overflows %s", value, c.Type)
+		}
+	}
+
+	return c, nil
+}
+
+// unaryConstant applies the unary operator op to x.
+func unaryConstant(op itemType, x *Constant) (*Constant, error) {
+	result := &Constant{Kind: x.Kind, Type: x.Type, basic: x.basic}
+
+	switch {
+	case op == itemNot && x.Kind == constantBool:
+		result.Value = !x.Value.(bool)
+	case op == itemPlus && isNumeric(x.Kind):
+		result.Value = x.Value
+	case op == itemMinus && isNumeric(x.Kind):
+		switch value := x.Value.(type) {
+		case *big.Int:
+			result.Value = new(big.Int).Neg(value)
+		case *big.Float:
+			result.Value = newFloat().Neg(value)
+		case complexValue:
+			result.Value = complexValue{newFloat().Neg(value.re), newFloat().Neg(value.im)}
+		}
+	case op == itemXor && (x.Kind == constantInt || x.Kind == constantRune):
+		value := new(big.Int).Not(x.Value.(*big.Int))
+
+		// the complement of a typed unsigned value keeps to its size
+		if basic := x.basic; basic != nil && basic.unsigned {
+			mask := new(big.Int).Lsh(big.NewInt(1), uint(basic.bits))
+			value.And(value, mask.Sub(mask, big.NewInt(1)))
+		}
+
+		result.Value = value
+	default:
+		return nil, fmt.Errorf("invalid operation: operator %s not defined on %s", operatorSpelling(op), x.describe())
+	}
+
+	return checkTyped(result)
+}
+
+// binaryConstant applies the binary operator op to x and y.
+func binaryConstant(op itemType, x *Constant, y *Constant) (*Constant, error) {
+	if op == itemShiftLeft || op == itemShiftRight {
+		return shiftConstant(op, x, y)
+	}
+
+	if x.Type != "" && y.Type != "" && x.Type != y.Type {
+		return nil, fmt.Errorf("mismatched types %s and %s", x.Type, y.Type)
+	}
+
+	// an untyped operand takes the type of the other one
+	var err error
+
+	if x.Type == "" && y.Type != "" {
+		x, err = convertConstant(x, y.Type, y.basic, false)
+	} else if y.Type == "" && x.Type != "" {
+		y, err = convertConstant(y, x.Type, x.basic, false)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if isNumeric(x.Kind) != isNumeric(y.Kind) || !isNumeric(x.Kind) && x.Kind != y.Kind {
+		return nil, fmt.Errorf("mismatched types %s and %s", x.describe(), y.describe())
+	}
+
+	kind := x.Kind
+
+	if y.Kind > kind {
+		kind = y.Kind
+	}
+
+	typ, basic := x.Type, x.basic
+
+	if typ == "" {
+		typ, basic = y.Type, y.basic
+	}
+
+	switch op {
+	case itemEqual, itemNotEqual, itemLower, itemLowerOrEqual, itemGreater, itemGreaterOrEqual:
+		return compareConstants(op, kind, x, y)
+	case itemAnd, itemOr:
+		if kind != constantBool {
+			break
+		}
+
+		if op == itemAnd {
+			return &Constant{Kind: kind, Type: typ, Value: x.Value.(bool) && y.Value.(bool), basic: basic}, nil
+		}
+
+		return &Constant{Kind: kind, Type: typ, Value: x.Value.(bool) || y.Value.(bool), basic: basic}, nil
+	case itemPlus:
+		if kind == constantString {
+			return &Constant{Kind: kind, Type: typ, Value: x.Value.(string) + y.Value.(string), basic: basic}, nil
+		}
+	}
+
+	if !isNumeric(kind) {
+		return nil, fmt.Errorf("operator %s not defined on %s", operatorSpelling(op), x.describe())
+	}
+
+	value, err := arithmetic(op, kind, toKind(x, kind), toKind(y, kind))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return checkTyped(&Constant{Kind: kind, Type: typ, Value: value, basic: basic})
+}
+
+func compareConstants(op itemType, kind constantKind, x *Constant, y *Constant) (*Constant, error) {
+	order := 0
+
+	switch a := toKind(x, kind).(type) {
+	case bool:
+		if a != y.Value.(bool) {
+			order = 1
+		}
+	case string:
+		b := y.Value.(string)
+
+		if a < b {
+			order = -1
+		} else if a > b {
+			order = 1
+		}
+	case *big.Int:
+		order = a.Cmp(toKind(y, kind).(*big.Int))
+	case *big.Float:
+		order = a.Cmp(toKind(y, kind).(*big.Float))
+	case complexValue:
+		b := toKind(y, kind).(complexValue)
+
+		if a.re.Cmp(b.re) != 0 || a.im.Cmp(b.im) != 0 {
+			order = 1
+		}
+
+		if op != itemEqual && op != itemNotEqual {
+			return nil, errors.New("operator " + operatorSpelling(op) + " not defined on complex constants")
+		}
+	}
+
+	if (kind == constantBool) && op != itemEqual && op != itemNotEqual {
+		return nil, errors.New("operator " + operatorSpelling(op) + " not defined on bool constants")
+	}
+
+	results := map[itemType]bool{
+		itemEqual:        order == 0,
+		itemNotEqual:     order != 0,
+		itemLower:          order < 0,
+		itemLowerOrEqual:    order <= 0,
+		itemGreater:       order > 0,
+		itemGreaterOrEqual: order >= 0,
+	}
+
+	return boolConstant(results[op]), nil
+}
+
+// arithmetic applies op to two numeric values of the same kind. Integer
+// division truncates, like for variables.
+func arithmetic(op itemType, kind constantKind, x interface{}, y interface{}) (interface{}, error) {
+	switch a := x.(type) {
+	case *big.Int:
+		b := y.(*big.Int)
+		result := new(big.Int)
+
+		switch op {
+		case itemPlus:
+			return result.Add(a, b), nil
+		case itemMinus:
+			return result.Sub(a, b), nil
+		case itemMupltiply:
+			return result.Mul(a, b), nil
+		case itemDivide, itemRest:
+			if b.Sign() == 0 {
+				return nil, errors.New("invalid operation: division by zero")
+			}
+
+			if op == itemDivide {
+				return result.Quo(a, b), nil
+			}
+
+			return result.Rem(a, b), nil
+		case itemAmpersand:
+			return result.And(a, b), nil
+		case itemPipe:
+			return result.Or(a, b), nil
+		case itemXor:
+			return result.Xor(a, b), nil
+		case itemAndNot:
+			return result.AndNot(a, b), nil
+		}
+	case *big.Float:
+		b := y.(*big.Float)
+
+		switch op {
+		case itemPlus:
+			return newFloat().Add(a, b), nil
+		case itemMinus:
+			return newFloat().Sub(a, b), nil
+		case itemMupltiply:
+			return newFloat().Mul(a, b), nil
+		case itemDivide:
+			if b.Sign() == 0 {
+				return nil, errors.New("invalid operation: division by zero")
+			}
+
+			return newFloat().Quo(a, b), nil
+		}
+	case complexValue:
+		b := y.(complexValue)
+
+		switch op {
+		case itemPlus:
+			return complexValue{newFloat().Add(a.re, b.re), newFloat().Add(a.im, b.im)}, nil
+		case itemMinus:
+			return complexValue{newFloat().Sub(a.re, b.re), newFloat().Sub(a.im, b.im)}, nil
+		case itemMupltiply:
+			re := newFloat().Sub(newFloat().Mul(a.re, b.re), newFloat().Mul(a.im, b.im))
+			im := newFloat().Add(newFloat().Mul(a.re, b.im), newFloat().Mul(a.im, b.re))
+
+			return complexValue{re, im}, nil
+		case itemDivide:
+			norm := newFloat().Add(newFloat().Mul(b.re, b.re), newFloat().Mul(b.im, b.im))
+
+			if norm.Sign() == 0 {
+				return nil, errors.New("invalid operation: division by zero")
+			}
+
+			re := newFloat().Add(newFloat().Mul(a.re, b.re), newFloat().Mul(a.im, b.im))
+			im := newFloat().Sub(newFloat().Mul(a.im, b.re), newFloat().Mul(a.re, b.im))
+
+			return complexValue{re.Quo(re, norm), im.Quo(im, norm)}, nil
+		}
+	}
+
+	names := map[constantKind]string{constantFloat: "float", constantComplex: "complex"}
+
+	return nil, fmt.Errorf("operator %s not defined on %s constants", operatorSpelling(op), names[kind])
+}
+
+// shiftConstant shifts the integer x by the non-negative integer count y.
+// The result keeps the type of x.
+func shiftConstant(op itemType, x *Constant, y *Constant) (*Constant, error) {
+	value, err := integerValue(x)
+
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := integerValue(y)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if count.Sign() < 0 {
+		return nil, fmt.Errorf("invalid shift count %s", count)
+	}
+
+	if !count.IsInt64() || count.Int64() > maxShift {
+		return nil, fmt.Errorf("shift count %s too large", count)
+	}
+
+	result := new(big.Int)
+
+	if op == itemShiftLeft {
+		result.Lsh(value, uint(count.Int64()))
+	} else {
+		result.Rsh(value, uint(count.Int64()))
+	}
+
+	kind := x.Kind
+
+	if kind != constantRune {
+		kind = constantInt
+	}
+
+	return checkTyped(&Constant{Kind: kind, Type: x.Type, Value: result, basic: x.basic})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Diagnostic is a message about the source, attached to the position it is
+// about.
+type Diagnostic struct {
+	Pos Position
+	Msg string
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s", d.Pos, d.Msg)
+}
+
+// DiagnosticList collects every diagnostic found while reading one file.
+type DiagnosticList []*Diagnostic
+
+// Add appends a diagnostic for pos.
+func (l *DiagnosticList) Add(pos Position, msg string) {
+	*l = append(*l, &Diagnostic{pos, msg})
+}
+
+func (l DiagnosticList) Len() int {
+	return len(l)
+}
+
+func (l DiagnosticList) Swap(i, j int) {
+	l[i], l[j] = l[j], l[i]
+}
+
+func (l DiagnosticList) Less(i, j int) bool {
+	return l[i].Pos.Offset < l[j].Pos.Offset
+}
+
+// Sort orders the list by source position.
+func (l DiagnosticList) Sort() {
+	sort.Stable(l)
+}
+
+func (l DiagnosticList) Error() string {
+	messages := make([]string, len(l))
+
+	for i, d := range l {
+		messages[i] = d.Error()
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// Err returns the list as an error, or nil when it is empty.
+func (l DiagnosticList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+
+	return l
+}
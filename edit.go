@@ -0,0 +1,187 @@
+package main
+
+import "reflect"
+
+// slot is the place of a node in its parent: a field holding one node, or
+// the element index of a field holding a list of nodes.
+type slot struct {
+	parent Node
+	field  reflect.Value
+	index  int // -1 when field holds a single node
+}
+
+// findSlot returns the slot of target in the tree rooted at root. Nodes are
+// compared by identity, two equal looking nodes are different nodes.
+func findSlot(root Node, target Node) (slot, bool) {
+	var found slot
+	ok := false
+
+	Inspect(root, func(node Node) bool {
+		if ok {
+			return false
+		}
+
+		if !isChild(node, target) {
+			return true
+		}
+
+		value := reflect.ValueOf(node).Elem()
+
+		for i := 0; i < value.NumField() && !ok; i++ {
+			field := value.Field(i)
+
+			if !field.CanSet() {
+				continue
+			}
+
+			switch field.Kind() {
+			case reflect.Interface, reflect.Ptr:
+				if !field.IsNil() && field.Interface() == interface{}(target) {
+					found, ok = slot{node, field, -1}, true
+				}
+			case reflect.Slice:
+				for j := 0; j < field.Len(); j++ {
+					if element := field.Index(j); !element.IsNil() && element.Interface() == interface{}(target) {
+						found, ok = slot{node, field, j}, true
+
+						break
+					}
+				}
+			}
+		}
+
+		return !ok
+	})
+
+	return found, ok
+}
+
+// isChild reports whether target is a child of node. Fields referring to
+// nodes held elsewhere in the tree, like FuncLit.Free, are not slots.
+func isChild(node Node, target Node) bool {
+	for _, child := range children(node) {
+		if child == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Lookup returns the node of the file with the given ID, or nil.
+func (f *File) Lookup(id NodeID) Node {
+	var found Node
+
+	Inspect(f, func(node Node) bool {
+		if node.ID() == id {
+			found = node
+		}
+
+		return found == nil
+	})
+
+	return found
+}
+
+// Parent returns the node that holds node, or nil if node is the file itself
+// or is not part of it.
+func (f *File) Parent(node Node) Node {
+	if s, ok := findSlot(f, node); ok {
+		return s.parent
+	}
+
+	return nil
+}
+
+// Replace puts replacement in the place of old. It fails if old is not part
+// of the file, if replacement is nil or if the place cannot hold a node of
+// that type. Nodes new to the tree get fresh IDs, the IDs of the other nodes
+// do not change.
+func (f *File) Replace(old Node, replacement Node) bool {
+	if replacement == nil || isNilNode(replacement) {
+		return false
+	}
+
+	s, ok := findSlot(f, old)
+
+	if !ok {
+		return false
+	}
+
+	target := s.field
+
+	if s.index >= 0 {
+		target = s.field.Index(s.index)
+	}
+
+	value := reflect.ValueOf(replacement)
+
+	if !value.Type().AssignableTo(target.Type()) {
+		return false
+	}
+
+	target.Set(value)
+	f.ids.number(replacement)
+	f.collectMethods()
+
+	return true
+}
+
+// Remove deletes node from the list that holds it. Nodes held by a field of
+// their own, such as the condition of an if statement, cannot be removed.
+func (f *File) Remove(node Node) bool {
+	s, ok := findSlot(f, node)
+
+	if !ok || s.index < 0 {
+		return false
+	}
+
+	list := s.field
+	rest := reflect.AppendSlice(list.Slice(0, s.index), list.Slice(s.index+1, list.Len()))
+	list.Set(rest)
+	f.collectMethods()
+
+	return true
+}
+
+// InsertBefore adds node to the list that holds ref, just before it.
+func (f *File) InsertBefore(ref Node, node Node) bool {
+	return f.insert(ref, node, 0)
+}
+
+// InsertAfter adds node to the list that holds ref, just after it.
+func (f *File) InsertAfter(ref Node, node Node) bool {
+	return f.insert(ref, node, 1)
+}
+
+// insert adds node to the list that holds ref, offset places after ref. It
+// fails like Replace does.
+func (f *File) insert(ref Node, node Node, offset int) bool {
+	if node == nil || isNilNode(node) {
+		return false
+	}
+
+	s, ok := findSlot(f, ref)
+
+	if !ok || s.index < 0 {
+		return false
+	}
+
+	list := s.field
+	value := reflect.ValueOf(node)
+
+	if !value.Type().AssignableTo(list.Type().Elem()) {
+		return false
+	}
+
+	at := s.index + offset
+	grown := reflect.MakeSlice(list.Type(), 0, list.Len()+1)
+	grown = reflect.AppendSlice(grown, list.Slice(0, at))
+	grown = reflect.Append(grown, value)
+	grown = reflect.AppendSlice(grown, list.Slice(at, list.Len()))
+	list.Set(grown)
+	f.ids.number(node)
+	f.collectMethods()
+
+	return true
+}
@@ -0,0 +1,122 @@
+package main
+
+import "testing"
+
+const editSource = "package main\n" +
+    "func main() {\n" +
+    "    var a int = 1\n" +
+    "    a = a + 1\n" +
+    "    fmt.Println(a)\n" +
+    "}\n"
+
+func TestNodeIDs(t *testing.T) {
+    first, _ := parse(newLexer("t.go", editSource))
+    second, _ := parse(newLexer("t.go", editSource))
+
+    var firstIDs, secondIDs []NodeID
+
+    Inspect(first, func(node Node) bool {
+        firstIDs = append(firstIDs, node.ID())
+
+        return true
+    })
+
+    Inspect(second, func(node Node) bool {
+        secondIDs = append(secondIDs, node.ID())
+
+        return true
+    })
+
+    if len(firstIDs) != len(secondIDs) {
+        t.Fatal("Expected the same number of nodes got", len(firstIDs), "and", len(secondIDs))
+    }
+
+    for i, id := range firstIDs {
+        if id != NodeID(i + 1) {
+            t.Error("Expected ID", i + 1, "in depth-first order got", id)
+        }
+
+        if secondIDs[i] != id {
+            t.Error("Expected the same IDs for the same source got", id, "and", secondIDs[i])
+        }
+    }
+}
+
+func TestEdit(t *testing.T) {
+    file, _ := parse(newLexer("t.go", editSource))
+    body := file.Decls[0].(*FuncDecl).Body
+    assignment := body.List[1].(*AssignStmt)
+    call := body.List[2]
+    last := file.ids.last
+
+    if file.Lookup(assignment.ID()) != assignment {
+        t.Error("Expected Lookup to find the assignment")
+    }
+
+    if file.Parent(assignment) != body {
+        t.Error("Expected the body to be the parent of the assignment")
+    }
+
+    // an identical but distinct statement is not part of the tree
+    if file.Remove(&AssignStmt{Lhs: assignment.Lhs, Tok: itemAssign, Rhs: assignment.Rhs}) {
+        t.Error("Expected a copy of the assignment not to be found")
+    }
+
+    two := &BasicLit{Kind: itemNumber, Text: "2"}
+
+    if !file.Replace(assignment.Rhs[0].(*BinaryExpr).Y, two) || assignment.Rhs[0].(*BinaryExpr).Y != two {
+        t.Error("Expected the literal to be replaced")
+    }
+
+    if two.ID() != last + 1 {
+        t.Error("Expected the new literal to get ID", last + 1, "got", two.ID())
+    }
+
+    if file.Replace(assignment.Lhs[0], &ReturnStmt{}) {
+        t.Error("Expected a statement not to replace an expression")
+    }
+
+    extra := &ExprStmt{X: &Ident{Name: "a"}}
+
+    if !file.InsertBefore(call, extra) || body.List[2] != extra || body.List[3] != call {
+        t.Error("Expected the statement to be inserted before the call")
+    }
+
+    if extra.ID() != last + 2 || extra.X.ID() != last + 3 {
+        t.Error("Expected the new statement and its child to get fresh IDs got", extra.ID(), extra.X.ID())
+    }
+
+    if !file.Remove(assignment) || len(body.List) != 3 || body.List[1] != extra {
+        t.Error("Expected the assignment to be removed")
+    }
+
+    if file.Remove(file.Package) {
+        t.Error("Expected the package name not to be removable")
+    }
+
+    if !file.InsertAfter(call, assignment) || body.List[3] != assignment {
+        t.Error("Expected the assignment to be inserted after the call")
+    }
+
+    if assignment.ID() == last + 4 {
+        t.Error("Expected a node moved back into the tree to keep its ID")
+    }
+}
+
+func TestEditNil(t *testing.T) {
+    file, _ := parse(newLexer("t.go", editSource))
+    body := file.Decls[0].(*FuncDecl).Body
+    call := body.List[2]
+
+    if file.Replace(call, nil) || body.List[2] != call {
+        t.Error("Expected nil not to replace the call")
+    }
+
+    if file.Replace(call, (*ExprStmt)(nil)) || body.List[2] != call {
+        t.Error("Expected a nil statement not to replace the call")
+    }
+
+    if file.InsertBefore(call, nil) || file.InsertAfter(call, (*ExprStmt)(nil)) || len(body.List) != 3 {
+        t.Error("Expected nil not to be inserted")
+    }
+}
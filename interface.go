@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// typeString spells the type expression x without the names of parameters
+// and results. Two types of the file are identical when their spellings
+// are.
+func typeString(x Expr) string {
+	switch x := x.(type) {
+	case *Ident:
+		return x.Name
+	case *BasicLit:
+		return x.Text
+	case *SelectorExpr:
+		return typeString(x.X) + "." + x.Sel.Name
+	case *StarExpr:
+		return "*" + typeString(x.X)
+	case *Ellipsis:
+		return "..." + typeString(x.Elt)
+	case *ArrayType:
+		if x.Len == nil {
+			return "[]" + typeString(x.Elt)
+		}
+
+		return "[" + typeString(x.Len) + "]" + typeString(x.Elt)
+	case *MapType:
+		return "map[" + typeString(x.Key) + "]" + typeString(x.Value)
+	case *FuncType:
+		return "func" + signatureString(x.Params, x.Results)
+	case *StructType:
+		var fields []string
+
+		for _, field := range x.Fields {
+			names := make([]string, len(field.Names))
+
+			for i, name := range field.Names {
+				names[i] = name.Name
+			}
+
+			fields = append(fields, strings.TrimSpace(strings.Join(names, ", ") + " " + typeString(field.Type)))
+		}
+
+		return "struct{" + strings.Join(fields, "; ") + "}"
+	case *InterfaceType:
+		var elements []string
+
+		for _, element := range x.Methods {
+			if len(element.Names) > 0 {
+				elements = append(elements, element.Names[0].Name + strings.TrimPrefix(typeString(element.Type), "func"))
+			} else {
+				elements = append(elements, typeString(element.Type))
+			}
+		}
+
+		return "interface{" + strings.Join(elements, "; ") + "}"
+	case *UnaryExpr:
+		return operatorSpelling(x.Op) + typeString(x.X)
+	case *BinaryExpr:
+		return typeString(x.X) + " " + operatorSpelling(x.Op) + " " + typeString(x.Y)
+	}
+
+	return "?"
+}
+
+// signatureString spells the parameters and the results of a function, as
+// in (int, ...string) (bool, error).
+func signatureString(params []*Field, results []*Field) string {
+	signature := "(" + strings.Join(fieldTypes(params), ", ") + ")"
+
+	switch types := fieldTypes(results); len(types) {
+	case 0:
+		return signature
+	case 1:
+		return signature + " " + types[0]
+	default:
+		return signature + " (" + strings.Join(types, ", ") + ")"
+	}
+}
+
+// fieldTypes spells the type of every parameter of fields, once for each of
+// their names.
+func fieldTypes(fields []*Field) []string {
+	var types []string
+
+	for _, field := range fields {
+		typ := typeString(field.Type)
+		types = append(types, typ)
+
+		for i := 1; i < len(field.Names); i++ {
+			types = append(types, typ)
+		}
+	}
+
+	return types
+}
+
+// typeDecl returns the package level declaration of the type name, or nil.
+func (f *File) typeDecl(name string) *TypeDecl {
+	for _, decl := range f.Decls {
+		decls := []Decl{decl}
+
+		if group, ok := decl.(*DeclGroup); ok {
+			decls = group.Decls
+		}
+
+		for _, decl := range decls {
+			if typ, ok := decl.(*TypeDecl); ok && typ.Name.Name == name {
+				return typ
+			}
+		}
+	}
+
+	return nil
+}
+
+// typeSet is what an interface requires from the types implementing it.
+// Every union of terms must have a term matching the type. complete is
+// false when the interface embeds one that is not declared in the file.
+type typeSet struct {
+	methods  map[string]*FuncType
+	unions   []Expr
+	complete bool
+}
+
+// errorMethod is the signature of the Error method of the predeclared error
+// interface.
+var errorMethod = &FuncType{Results: []*Field{{Type: &Ident{Name: "string"}}}}
+
+// interfaceTypeSet collects the methods and the unions of iface and of the
+// interfaces it embeds.
+func (f *File) interfaceTypeSet(iface *InterfaceType) *typeSet {
+	set := &typeSet{methods: map[string]*FuncType{}, complete: true}
+	seen := map[*InterfaceType]bool{}
+
+	var add func(iface *InterfaceType)
+
+	add = func(iface *InterfaceType) {
+		if seen[iface] {
+			return
+		}
+
+		seen[iface] = true
+
+		for _, element := range iface.Methods {
+			if len(element.Names) > 0 {
+				set.methods[element.Names[0].Name] = element.Type.(*FuncType)
+
+				continue
+			}
+
+			switch typ := element.Type.(type) {
+			case *InterfaceType:
+				add(typ)
+			case *SelectorExpr:
+				// an interface of another package
+				set.complete = false
+			case *Ident:
+				declaration := f.typeDecl(typ.Name)
+
+				switch {
+				case declaration != nil:
+					if embedded, ok := declaration.Type.(*InterfaceType); ok {
+						add(embedded)
+					} else {
+						set.unions = append(set.unions, typ)
+					}
+				case typ.Name == "error":
+					set.methods["Error"] = errorMethod
+				case typ.Name == "any" || typ.Name == "comparable":
+					// comparable is not checked
+				case predeclared[typ.Name] == predeclaredType:
+					set.unions = append(set.unions, typ)
+				default:
+					set.complete = false
+				}
+			default:
+				set.unions = append(set.unions, element.Type)
+			}
+		}
+	}
+
+	add(iface)
+
+	return set
+}
+
+// isConstraint reports whether iface has type terms, which only allow it as
+// a constraint.
+func (f *File) isConstraint(iface *InterfaceType) bool {
+	return len(f.interfaceTypeSet(iface).unions) > 0
+}
+
+// Implements reports whether the type name of the file, or *name when
+// pointer is set, implements iface: it has all its methods, with identical
+// signatures, and matches a term of every union of a constraint. The
+// reason it does not is given the way the compiler does, as in missing
+// method Close. The answer is yes when it cannot be decided from this file
+// alone, like for interfaces of other packages or promoted methods.
+func (f *File) Implements(name string, pointer bool, iface *InterfaceType) (bool, string) {
+	set := f.interfaceTypeSet(iface)
+	declaration := f.typeDecl(name)
+
+	if !set.complete || declaration == nil {
+		return true, ""
+	}
+
+	spelling := name
+
+	if pointer {
+		spelling = "*" + name
+	}
+
+	for _, union := range set.unions {
+		if !matchesUnion(spelling, declaration, union) {
+			return false, fmt.Sprintf("%s missing in %s", spelling, typeString(union))
+		}
+	}
+
+	have := map[string]*FuncType{}
+	pointerOnly := map[string]bool{}
+
+	switch underlying := declaration.Type.(type) {
+	case *InterfaceType:
+		if !pointer {
+			own := f.interfaceTypeSet(underlying)
+
+			if !own.complete {
+				return true, ""
+			}
+
+			have = own.methods
+		}
+	case *StructType:
+		for _, field := range underlying.Fields {
+			// methods promoted from embedded fields are not known here
+			if len(field.Names) == 0 {
+				return true, ""
+			}
+		}
+	}
+
+	for _, method := range f.Methods[name] {
+		signature := &FuncType{Params: method.Params, Results: method.Results}
+
+		if _, star := receiverBase(method.Recv); star && !pointer {
+			pointerOnly[method.Name.Name] = true
+		} else {
+			have[method.Name.Name] = signature
+		}
+	}
+
+	names := make([]string, 0, len(set.methods))
+
+	for name := range set.methods {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		want := set.methods[name]
+		method, ok := have[name]
+
+		switch {
+		case !ok && pointerOnly[name]:
+			return false, fmt.Sprintf("method %s has pointer receiver", name)
+		case !ok:
+			return false, fmt.Sprintf("missing method %s", name)
+		case typeString(method) != typeString(want):
+			return false, fmt.Sprintf("wrong type for method %s", name)
+		}
+	}
+
+	return true, ""
+}
+
+// matchesUnion reports whether the type spelling, declared by declaration,
+// is one of the terms of union. A ~T term matches the types with the
+// underlying type T.
+func matchesUnion(spelling string, declaration *TypeDecl, union Expr) bool {
+	switch term := union.(type) {
+	case *BinaryExpr:
+		return matchesUnion(spelling, declaration, term.X) || matchesUnion(spelling, declaration, term.Y)
+	case *UnaryExpr:
+		return !strings.HasPrefix(spelling, "*") && typeString(declaration.Type) == typeString(term.X)
+	}
+
+	return spelling == typeString(union)
+}
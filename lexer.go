@@ -11,18 +11,16 @@ import (
 type stateFn func(*lexer) stateFn
 type doubleStateFn func(*lexer, itemType) stateFn
 
+// Pos is a byte offset into the input of a lexer. SourceFile.Position turns
+// it into a file:line:column location.
 type Pos int
 
-func (p Pos) Position() Pos {
-	return p
-}
-
-
 type item struct {
-	typ  itemType
-	pos  Pos
-	val  string
-	line int
+	typ   itemType
+	pos   Pos // offset of the first byte
+	end   Pos // offset just past the last byte
+	val   string
+	value interface{} // decoded value of a literal, see literal.go
 }
 
 func (i item) String() string {
@@ -41,28 +39,35 @@ func (i item) String() string {
 
 type itemType int
 
+// keyWords holds the 25 keywords of the Go spec. Predeclared identifiers such
+// as int or true are not keywords, they are lexed as identifiers and resolved
+// by the parser through the universe block.
 var keyWords = map[string]itemType{
-    ".":        itemDot,
-    "block":    itemBlock,
-    "define":   itemDefine,
-    "else":     itemElse,
-    "end":      itemEnd,
-    "if":       itemIf,
-    "range":    itemRange,
-    "nil":      itemNil,
-    "template": itemTemplate,
-    "with":     itemWith,
-    "for": itemFor,
-    "package": itemPackage,
-    "import": itemImport,
-    "func": itemFunctionDefine,
-    "map": itemMap,
-    "var": itemVar,
-    "int": itemIntType,
-    "byte": itemByteType,
-    "bool": itemBoolType,
-    "string": itemStringType,
-	"return": itemReturn,
+	"break":       itemBreak,
+	"case":        itemCase,
+	"chan":        itemChan,
+	"const":       itemConst,
+	"continue":    itemContinue,
+	"default":     itemDefault,
+	"defer":       itemDefer,
+	"else":        itemElse,
+	"fallthrough": itemFallthrough,
+	"for":         itemFor,
+	"func":        itemFunctionDefine,
+	"go":          itemGo,
+	"goto":        itemGoto,
+	"if":          itemIf,
+	"import":      itemImport,
+	"interface":   itemInterface,
+	"map":         itemMap,
+	"package":     itemPackage,
+	"range":       itemRange,
+	"return":      itemReturn,
+	"select":      itemSelect,
+	"struct":      itemStruct,
+	"switch":      itemSwitch,
+	"type":        itemTypeDefine,
+	"var":         itemVar,
 }
 
 type lexer struct {
@@ -70,87 +75,112 @@ type lexer struct {
 	pos            Pos
 	start          Pos
 	width          Pos
+	state          stateFn
+	pending        []item
 	items          chan item
-	line           int
-	startLine      int
-	currentPosOnLine Pos
-	currentStartOnLine Pos
+	file           *SourceFile
 	previousUnknown bool
+	insertSemi     bool
 }
 
 const (
 	itemError        itemType = iota
-	itemBool
-	itemChar
 	itemCharConstant
-	itemAssign
-	itemDeclare
 	itemEOF
 	itemFunction
 	itemField
 	itemIdentifier
-	itemLeftDelim
-	itemLeftParen
 	itemNumber
-	itemPipe
 	itemRawString
-	itemRightDelim
-	itemRightParen
 	itemSpace
 	itemString
 	itemText
 	itemVariable
-	itemKeyword
-	itemBlock
-	itemDot
-	itemDefine
-	itemElse
-	itemEnd
-	itemIf
-	itemNil
-	itemRange
-	itemTemplate
-	itemWith
-	itemFor
-	itemDoublePlus
-	itemDoubleMinus
-	itemMinus
-	itemPlus
 	itemNewLine
-	// header types
-	itemPackage
 	itemPackageValue
-	itemImport
 	itemImportValue
-	itemFunctionDefine
-	itemNotEqual
 	itemFunctionName
 	itemVariableType
-	itemMap
-	itemVar
-	itemColon
-	itemByteType
-	itemStringType
-	itemIntType
 	itemUnknownToken
-	itemSemiColon
 	itemComment
 	itemNode
 	itemCalledLibrary
-	itemEqual
-	itemMupltiply
-	itemDivide
-	itemNot
-	itemGreater
-	itemLower
-	itemGreaterOrEqual
-	itemLowerOrEqual
-	itemOr
-	itemAnd
-	itemReturn
-	itemBoolType
 	itemIndex
-	itemRest
+	// operators and delimiters
+	itemPlus             // +
+	itemMinus            // -
+	itemMupltiply        // *
+	itemDivide           // /
+	itemRest             // %
+	itemAmpersand        // &
+	itemPipe             // |
+	itemXor              // ^
+	itemShiftLeft        // <<
+	itemShiftRight       // >>
+	itemAndNot           // &^
+	itemPlusAssign       // +=
+	itemMinusAssign      // -=
+	itemMultiplyAssign   // *=
+	itemDivideAssign     // /=
+	itemRestAssign       // %=
+	itemAmpersandAssign  // &=
+	itemPipeAssign       // |=
+	itemXorAssign        // ^=
+	itemShiftLeftAssign  // <<=
+	itemShiftRightAssign // >>=
+	itemAndNotAssign     // &^=
+	itemAnd              // &&
+	itemOr               // ||
+	itemArrow            // <-
+	itemDoublePlus       // ++
+	itemDoubleMinus      // --
+	itemEqual            // ==
+	itemLower            // <
+	itemGreater          // >
+	itemAssign           // =
+	itemNot              // !
+	itemTilde            // ~
+	itemNotEqual         // !=
+	itemLowerOrEqual     // <=
+	itemGreaterOrEqual   // >=
+	itemDeclare          // :=
+	itemEllipsis         // ...
+	itemLeftParen        // (
+	itemLeftBrack        // [
+	itemLeftDelim        // {
+	itemComma            // ,
+	itemDot              // .
+	itemRightParen       // )
+	itemRightBrack       // ]
+	itemRightDelim       // }
+	itemSemiColon        // ;
+	itemColon            // :
+	itemKeyword
+	itemBreak
+	itemCase
+	itemChan
+	itemConst
+	itemContinue
+	itemDefault
+	itemDefer
+	itemElse
+	itemFallthrough
+	itemFor
+	itemFunctionDefine
+	itemGo
+	itemGoto
+	itemIf
+	itemImport
+	itemInterface
+	itemMap
+	itemPackage
+	itemRange
+	itemReturn
+	itemSelect
+	itemStruct
+	itemSwitch
+	itemTypeDefine
+	itemVar
 )
 
 const eof = -1
@@ -165,11 +195,6 @@ func (l *lexer) next() rune {
 	r, w := utf8.DecodeRuneInString(l.input[l.pos:])
 	l.width = Pos(w)
 	l.pos += l.width
-	l.currentPosOnLine += l.width
-
-	if r == '\n' {
-		l.line++
-	}
 
 	return r
 }
@@ -183,21 +208,42 @@ func (l *lexer) peek() rune {
 
 func (l *lexer) backup() {
 	l.pos -= l.width
-	l.currentPosOnLine -= l.width
-
-	if l.width == 1 && l.input[l.pos] == '\n' {
-		l.line--
-	}
 }
 
 func (l *lexer) emit(t itemType) {
-	// if t == itemSpace {
-	// 	fmt.Println(l.input[l.start:l.pos])
-	// }
-	l.items <- item{t, l.currentStartOnLine, l.input[l.start:l.pos], l.startLine}
+	l.emitValue(t, nil)
+}
+
+// emitValue emits an item that carries the decoded value of a literal.
+func (l *lexer) emitValue(t itemType, value interface{}) {
+	l.pending = append(l.pending, item{t, l.start, l.pos, l.input[l.start:l.pos], value})
 	l.start = l.pos
-	l.currentStartOnLine = l.currentPosOnLine
-	l.startLine = l.line
+
+	if t != itemSpace && t != itemComment && t != itemNewLine {
+		l.insertSemi = endsStatement(t)
+	}
+}
+
+// endsStatement reports whether a newline after a token of type t terminates
+// the statement, following the semicolon insertion rule of the Go spec.
+func endsStatement(t itemType) bool {
+	switch t {
+	case itemIdentifier, itemPackageValue, itemFunctionName, itemField,
+		itemNumber, itemString, itemRawString, itemCharConstant,
+		itemBreak, itemContinue, itemFallthrough, itemReturn,
+		itemDoublePlus, itemDoubleMinus,
+		itemRightParen, itemRightBrack, itemRightDelim:
+		return true
+	}
+
+	return false
+}
+
+// insertSemicolon emits a semicolon that has no spelling of its own in the
+// input, for a statement ended by a comment or by the end of the input.
+func (l *lexer) insertSemicolon() {
+	l.pending = append(l.pending, item{itemSemiColon, l.start, l.start, "\n", nil})
+	l.insertSemi = false
 }
 
 func (l *lexer) accept(valid string) bool {
@@ -217,21 +263,61 @@ func (l *lexer) acceptRun(valid string) {
 	l.backup()
 }
 
+// errorf reports a lexical error about the text scanned since l.start. That
+// text is dropped and lexing goes on with the next token.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{itemError, l.currentStartOnLine, fmt.Sprintf(format, args...), l.startLine}
+	l.pending = append(l.pending, item{itemError, l.start, l.pos, fmt.Sprintf(format, args...), nil})
+	l.start = l.pos
+
+	return lexAction
+}
+
+// literalError reports a malformed literal at the offending character. The
+// literal is still emitted, without a value, so that parsing can go on.
+func (l *lexer) literalError(err *literalError, t itemType) stateFn {
+	l.pending = append(l.pending, item{itemError, l.start + Pos(err.offset), l.pos, err.msg, nil})
+	l.emit(t)
 
-	return nil
+	return lexAction
 }
 
-func lex(input string) *lexer {
-	l := &lexer{
+// newLexer creates a lexer that is driven by the caller: every NextToken call
+// runs the state machine just far enough to produce one item, so nothing is
+// left running when the caller stops reading. name is only used to report
+// positions.
+func newLexer(name string, input string) *lexer {
+	return &lexer{
 		input:          input,
-		items:          make(chan item),
-		line:           1,
-		startLine:      1,
-		currentPosOnLine: 1,
+		state:          lexAction,
+		file:           newSourceFile(name, input),
 		previousUnknown : false,
 	}
+}
+
+// NextToken returns the next item of the input. Lexical errors are returned
+// as itemError and lexing goes on after them. After the last item NextToken
+// keeps returning itemEOF.
+func (l *lexer) NextToken() item {
+	for len(l.pending) == 0 {
+		if l.state == nil {
+			return item{itemEOF, l.pos, l.pos, "", nil}
+		}
+
+		l.state = l.state(l)
+	}
+
+	next := l.pending[0]
+	l.pending = append(l.pending[:0], l.pending[1:]...)
+
+	return next
+}
+
+// lex starts a lexer that delivers its items over the items channel. It is an
+// adapter over NextToken for callers that want to range over the items; the
+// channel is closed before itemEOF and must be drained by the caller.
+func lex(name string, input string) *lexer {
+	l := newLexer(name, input)
+	l.items = make(chan item)
 
 	go l.run()
 
@@ -239,8 +325,8 @@ func lex(input string) *lexer {
 }
 
 func (l *lexer) run() {
-	for state := lexAction; state != nil; {
-		state = state(l)
+	for next := l.NextToken(); next.typ != itemEOF; next = l.NextToken() {
+		l.items <- next
 	}
 
 	close(l.items)
@@ -254,37 +340,23 @@ const (
 func lexAction(l *lexer) stateFn {
 	switch r := l.next(); {
 	  case r == '\n':
-			l.currentPosOnLine = Pos(0)
+			if l.insertSemi {
+				return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemSemiColon)
+			}
 
 			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemNewLine)
 		case r == eof:
+			if l.insertSemi {
+				l.insertSemicolon()
+			}
+
 			return nil;
 		case isSpace(r):
 			l.backup()
 
 			return lexWithUnknownCondition(l, lexSpace)
-		case r == '=':
-	    nextRune := l.peek()
-
-			if nextRune == '=' && r == '=' {
-				return lexWithUnknownConditionAndDoubleArguments(l, lexDoubleSign, itemEqual)
-			}
-
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemAssign)
-		case r == ':':
-			return lexWithUnknownCondition(l, lexDeclareOrColon)
-		case r == '|':
-			nextRune := l.peek()
-
-			if nextRune == '|' && r == '|' {
-				return lexWithUnknownConditionAndDoubleArguments(l, lexDoubleSign, itemOr)
-			}
-
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemPipe)
 		case r == '"':
 			return lexWithUnknownCondition(l, lexQuote)
-		case r == '%':
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemRest)
 		case r == '`':
 			return lexWithUnknownCondition(l, lexRawQuote)
 		case r == '$':
@@ -300,94 +372,29 @@ func lexAction(l *lexer) stateFn {
 				return lexWithUnknownCondition(l, lexOneLineComment)
 			}
 
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemDivide)
+			return lexWithUnknownCondition(l, lexOperator)
 		case r == '\'':
 			return lexWithUnknownCondition(l, lexChar)
 		case r == '.':
+			if strings.HasPrefix(l.input[l.pos:], "..") {
+				return lexWithUnknownCondition(l, lexOperator)
+			}
+
 			if l.pos < Pos(len(l.input)) {
 				r := l.input[l.pos]
 
-				if r < '0' || '9' < r {
-					return lexWithUnknownCondition(l, lexField)
+				if '0' <= r && r <= '9' {
+					return lexWithUnknownCondition(l, lexNumber)
 				}
 			}
 
-			fallthrough
-		case r == '+' || r == '-':
-			nextRune := l.peek()
-
-			if nextRune == '+' && r == '+' {
-					return lexWithUnknownConditionAndDoubleArguments(l, lexDoubleSign, itemDoublePlus)
-			}
-
-			if nextRune == '-' && r == '-' {
-					return lexWithUnknownConditionAndDoubleArguments(l, lexDoubleSign, itemDoubleMinus)
-			}
-
-			if nextRune != '+' && r == '+' {
-				return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemPlus)
-			}
-
-			if nextRune != '-' && r == '-' {
-				return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemMinus)
-			}
-		case r == '*':
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemMupltiply)
-		case r == '{':
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemLeftDelim)
-		case r == '}':
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemRightDelim)
-		case r == '!':
-			if l.previousUnknown {
-				return lexUnknownToken
-			}
-
-			subRune := l.peek()
-
-			if subRune == '=' {
-				l.pos += Pos(1)
-				l.emit(itemNotEqual)
-
-				return lexAction
-			}
-
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemNot)
+			return lexWithUnknownCondition(l, lexField)
 		case ('0' <= r && r <= '9'):
 			return lexWithUnknownCondition(l, lexNumber)
 		case isAlphaNumeric(r):
 			return lexWithUnknownCondition(l, lexIdentifier)
-		case r == '(':
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemLeftParen)
-		case r == ')':
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemRightParen)
-		case r == ';':
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemSemiColon)
-		case r == '>':
-			nextRune := l.peek()
-
-		    if nextRune == '=' && r == '>' {
-				return lexWithUnknownConditionAndDoubleArguments(l, lexDoubleSign, itemGreaterOrEqual)
-		    }
-
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemGreater)
-		case r == '&':
-			nextRune := l.peek()
-
-			if nextRune == '&' && r == '&' {
-				return lexWithUnknownConditionAndDoubleArguments(l, lexDoubleSign, itemAnd)
-			}
-
-			fallthrough
-		case r == '<':
-			nextRune := l.peek()
-
-			if nextRune == '=' && r == '<' {
-				return lexWithUnknownConditionAndDoubleArguments(l, lexDoubleSign, itemLowerOrEqual)
-			}
-
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemLower)
-		case r == ',' || r == '[' || r == ']':
-			return lexWithUnknownConditionAndDoubleArguments(l, lexDefaultToken, itemChar)
+		case strings.ContainsRune(operatorRunes, r):
+			return lexWithUnknownCondition(l, lexOperator)
 		default:
 			l.previousUnknown = true
 	}
@@ -412,28 +419,38 @@ func lexWithUnknownConditionAndDoubleArguments(l *lexer, lexState doubleStateFn,
 }
 
 func lexMultilineComment(l *lexer) stateFn {
-	if n := strings.Index(string(l.input[l.start:]), "*/"); n != -1 {
-		l.pos = l.start + Pos(n + 2)
+	n := strings.Index(string(l.input[l.start:]), "*/")
 
-		if countNewLines := strings.Count(string(l.input[l.start:l.pos]), "\n"); n > 0 {
-			l.line +=  countNewLines
-			l.currentPosOnLine = Pos(len(l.input[l.start: l.pos]) - strings.LastIndex(string(l.input[l.start: l.pos]), "\n"))
+	if n == -1 {
+		l.pos = Pos(len(l.input))
+
+		return l.literalError(literalErrorf(0, "comment not terminated"), itemComment)
+	}
+
+	l.pos = l.start + Pos(n + 2)
+
+	if strings.Contains(l.input[l.start:l.pos], "\n") {
+		// a comment spanning lines acts like a newline
+		if l.insertSemi {
+			l.insertSemicolon()
 		}
 
-		l.emit(itemComment)
 	}
 
+	l.emit(itemComment)
+
 	return lexAction
 }
 
 func lexOneLineComment(l *lexer) stateFn {
 	if n := strings.Index(string(l.input[l.start:]), "\n"); n != -1 {
 		l.pos = l.start + Pos(n)
-		l.currentPosOnLine = Pos(len(l.input[l.start:l.pos]))
-
-		l.emit(itemComment)
+	} else {
+		l.pos = Pos(len(l.input))
 	}
 
+	l.emit(itemComment)
+
 	return lexAction
 }
 
@@ -454,15 +471,82 @@ func lexDefaultToken(l *lexer, expectedType itemType) stateFn {
 	return lexAction
 }
 
-func lexDeclareOrColon(l *lexer) stateFn {
-	if l.peek() == '=' {
-		l.next()
-		l.emit(itemDeclare)
-	} else {
-		l.emit(itemColon)
+// operators maps the spelling of every operator and delimiter of the Go spec
+// to its item type.
+var operators = map[string]itemType{
+	"+":   itemPlus,
+	"-":   itemMinus,
+	"*":   itemMupltiply,
+	"/":   itemDivide,
+	"%":   itemRest,
+	"&":   itemAmpersand,
+	"|":   itemPipe,
+	"^":   itemXor,
+	"<<":  itemShiftLeft,
+	">>":  itemShiftRight,
+	"&^":  itemAndNot,
+	"+=":  itemPlusAssign,
+	"-=":  itemMinusAssign,
+	"*=":  itemMultiplyAssign,
+	"/=":  itemDivideAssign,
+	"%=":  itemRestAssign,
+	"&=":  itemAmpersandAssign,
+	"|=":  itemPipeAssign,
+	"^=":  itemXorAssign,
+	"<<=": itemShiftLeftAssign,
+	">>=": itemShiftRightAssign,
+	"&^=": itemAndNotAssign,
+	"&&":  itemAnd,
+	"||":  itemOr,
+	"<-":  itemArrow,
+	"++":  itemDoublePlus,
+	"--":  itemDoubleMinus,
+	"==":  itemEqual,
+	"<":   itemLower,
+	">":   itemGreater,
+	"=":   itemAssign,
+	"!":   itemNot,
+	"~":   itemTilde,
+	"!=":  itemNotEqual,
+	"<=":  itemLowerOrEqual,
+	">=":  itemGreaterOrEqual,
+	":=":  itemDeclare,
+	"...": itemEllipsis,
+	"(":   itemLeftParen,
+	"[":   itemLeftBrack,
+	"{":   itemLeftDelim,
+	",":   itemComma,
+	".":   itemDot,
+	")":   itemRightParen,
+	"]":   itemRightBrack,
+	"}":   itemRightDelim,
+	";":   itemSemiColon,
+	":":   itemColon,
+}
+
+// operatorRunes holds every rune an operator or a delimiter can start with.
+const operatorRunes = "+-*/%&|^<>=!~:.,;()[]{}"
+
+// lexOperator scans the longest operator that starts at l.start. The first
+// rune of it has already been consumed by lexAction.
+func lexOperator(l *lexer) stateFn {
+	for size := 3; size > 0; size-- {
+		if int(l.start) + size > len(l.input) {
+			continue
+		}
+
+		if typ, ok := operators[l.input[l.start:l.start + Pos(size)]]; ok {
+			for l.pos < l.start + Pos(size) {
+				l.next()
+			}
+
+			l.emit(typ)
+
+			return lexAction
+		}
 	}
 
-	return lexAction
+	return l.errorf("unexpected operator %q", l.input[l.start:l.pos])
 }
 
 func lexSpace(l *lexer) stateFn {
@@ -506,8 +590,6 @@ func lexIdentifier(l *lexer) stateFn {
 				l.emit(keyWords[word])
 
 		        if keyWords[word] == itemPackage {
-							l.currentPosOnLine -= Pos(1)
-
 		          return lexPackageValue
 		        }
 
@@ -520,8 +602,6 @@ func lexIdentifier(l *lexer) stateFn {
 				// }
 			// case l.peek() == '(':
 	        // 	l.emit(itemFunction)
-			case word == "true", word == "false":
-				l.emit(itemBool)
 				default:
 					l.emit(itemIdentifier)
 				}
@@ -536,13 +616,13 @@ func lexIdentifier(l *lexer) stateFn {
 func lexFunctionDefine(l *lexer) stateFn {
   for {
     switch r := l.next(); {
-      case isSpace(r):
-		if strings.TrimSpace(string(l.input[l.start:l.pos])) != "" {
-			l.emit(itemUnknownToken)
-
-			break
-		}
+      case isSpace(r) && l.pos - 1 > l.start:
+		// the name ends before the white space, as in func main ()
+		l.backup()
+		l.emit(itemFunctionName)
 
+		return lexAction
+      case isSpace(r):
         l.emit(itemSpace)
 
         break
@@ -552,6 +632,12 @@ func lexFunctionDefine(l *lexer) stateFn {
       	l.backup()
       	word := l.input[l.start:l.pos]
 
+      	// a receiver, as in func (r T) Name(), or the parameters of a
+      	// function literal: the name, if any, is lexed as an identifier
+      	if word == "" {
+      		return lexAction
+      	}
+
       	if !l.atTerminator() {
       		return l.errorf("bad character %s %#U", word, r)
       	}
@@ -566,6 +652,12 @@ func lexFunctionDefine(l *lexer) stateFn {
 func lexPackageValue(l *lexer) stateFn {
 	for {
 		switch r := l.next(); {
+			case isSpace(r) && l.pos - 1 > l.start:
+				// the name ends before the white space
+				l.backup()
+				l.emit(itemPackageValue)
+
+				return lexAction
 			case isSpace(r):
 				l.emit(itemSpace)
 
@@ -576,6 +668,11 @@ func lexPackageValue(l *lexer) stateFn {
 				l.backup()
 				word := l.input[l.start:l.pos]
 
+				if word == "" {
+					// the name is missing, the parser reports it
+					return lexAction
+				}
+
 				if !l.atTerminator() {
 					return l.errorf("bad character %s %#U", word, r)
 				}
@@ -585,8 +682,6 @@ func lexPackageValue(l *lexer) stateFn {
 				return lexAction
 		}
 	}
-
-	return l.errorf("expected package value")
 }
 
 func lexField(l *lexer) stateFn {
@@ -644,9 +739,8 @@ func (l *lexer) atTerminator() bool {
 		return true
 	}
 
-	switch r {
-  case eof, '.', ',', '|', ':', ')', '(', '[', ']', '{', '}', ';':
-    	return true
+	if r == eof || strings.ContainsRune(operatorRunes, r) {
+		return true
 	}
 
 	return false
@@ -663,13 +757,21 @@ func lexChar(l *lexer) stateFn {
 
 				fallthrough
 			case eof, '\n':
-				return l.errorf("unterminated character constant")
+				l.backup()
+
+				return l.literalError(literalErrorf(0, "unterminated character constant"), itemCharConstant)
 			case '\'':
 				break Loop
 			}
 		}
 
-	l.emit(itemCharConstant)
+	value, err := decodeRune(l.input[l.start:l.pos])
+
+	if err != nil {
+		return l.literalError(err, itemCharConstant)
+	}
+
+	l.emitValue(itemCharConstant, value)
 
 	return lexAction
 }
@@ -678,32 +780,31 @@ func lexNumber(l *lexer) stateFn {
 	l.backup()
 
 	if !l.scanNumber() {
-		return l.errorf("bad number syntax: %q", l.input[l.start:l.pos])
+		for isAlphaNumeric(l.peek()) {
+			l.next()
+		}
+
+		return l.literalError(literalErrorf(0, "bad number syntax: %q", l.input[l.start:l.pos]), itemNumber)
 	}
 
-	l.emit(itemNumber)
+	value, err := decodeNumber(l.input[l.start:l.pos])
 
-	return lexAction
-}
+	if err != nil {
+		return l.literalError(err, itemNumber)
+	}
 
-func lexDoubleSign(l *lexer, expectedType itemType) stateFn {
-  l.pos += Pos(1)
-  l.currentPosOnLine += Pos(1)
-  l.emit(expectedType)
+	l.emitValue(itemNumber, value)
 
-  return lexAction
+	return lexAction
 }
 
+// scanNumber consumes the extent of a number literal. Digits that are invalid
+// for the base are still consumed here, decodeNumber reports them precisely.
 func (l *lexer) scanNumber() bool {
 	digits := "0123456789_"
-	if l.accept("0") {
-		if l.accept("xX") {
-			digits = "0123456789abcdefABCDEF_"
-		} else if l.accept("oO") {
-			digits = "01234567_"
-		} else if l.accept("bB") {
-			digits = "01_"
-		}
+
+	if l.accept("0") && l.accept("xXoObB") && strings.ContainsRune("xX", rune(l.input[l.pos - 1])) {
+		digits = "0123456789abcdefABCDEF_"
 	}
 
 	l.acceptRun(digits)
@@ -712,12 +813,7 @@ func (l *lexer) scanNumber() bool {
 		l.acceptRun(digits)
 	}
 
-	if len(digits) == 10+1 && l.accept("eE") {
-		l.accept("+-")
-		l.acceptRun("0123456789_")
-	}
-
-	if len(digits) == 16+6+1 && l.accept("pP") {
+	if len(digits) == 10+1 && l.accept("eE") || len(digits) == 16+6+1 && l.accept("pP") {
 		l.accept("+-")
 		l.acceptRun("0123456789_")
 	}
@@ -744,13 +840,21 @@ func lexQuote(l *lexer) stateFn {
 
 				fallthrough
 			case eof, '\n':
-				return l.errorf("unterminated quoted string")
+				l.backup()
+
+				return l.literalError(literalErrorf(0, "unterminated quoted string"), itemString)
 			case '"':
 				break Loop
 			}
 		}
 
-	l.emit(itemString)
+	value, err := decodeString(l.input[l.start:l.pos])
+
+	if err != nil {
+		return l.literalError(err, itemString)
+	}
+
+	l.emitValue(itemString, value)
 
 	return lexAction
 }
@@ -760,19 +864,22 @@ func lexRawQuote(l *lexer) stateFn {
 		for {
 			switch l.next() {
 			case eof:
-				return l.errorf("unterminated raw quoted string")
+				return l.literalError(literalErrorf(0, "unterminated raw quoted string"), itemRawString)
 			case '`':
 				break Loop
 			}
 		}
 
-	l.emit(itemRawString)
+	value, _ := decodeString(l.input[l.start:l.pos])
+	l.emitValue(itemRawString, value)
 
 	return lexAction
 }
 
+// isSpace reports whether r is white space other than a newline. Like in
+// Go, a carriage return is white space, so CRLF line endings read as LF.
 func isSpace(r rune) bool {
-	return r == ' ' || r == '\t'
+	return r == ' ' || r == '\t' || r == '\r'
 }
 
 func isEndOfLine(r rune) bool {
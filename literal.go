@@ -0,0 +1,371 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// floatPrecision is the mantissa size, in bits, of decoded float literals.
+const floatPrecision = 512
+
+// imaginary is the decoded value of an imaginary literal such as 2.5i.
+type imaginary struct {
+	im *big.Float
+}
+
+func (i imaginary) String() string {
+	return i.im.Text('g', -1) + "i"
+}
+
+// literalError describes a malformed literal. offset is the byte offset of
+// the offending character relative to the start of the literal.
+type literalError struct {
+	offset int
+	msg    string
+}
+
+func (e *literalError) Error() string {
+	return e.msg
+}
+
+func literalErrorf(offset int, format string, args ...interface{}) *literalError {
+	return &literalError{offset, fmt.Sprintf(format, args...)}
+}
+
+// decodeNumber converts the spelling of an integer, float or imaginary
+// literal into a *big.Int, a *big.Float or an imaginary value.
+func decodeNumber(text string) (interface{}, *literalError) {
+	body := text
+	isImaginary := strings.HasSuffix(body, "i")
+
+	if isImaginary {
+		body = body[:len(body) - 1]
+	}
+
+	base, prefix := 10, ""
+
+	if len(body) >= 2 && body[0] == '0' {
+		switch lower(body[1]) {
+		case 'x':
+			base, prefix = 16, "hexadecimal"
+		case 'o':
+			base, prefix = 8, "octal"
+		case 'b':
+			base, prefix = 2, "binary"
+		}
+	}
+
+	digitsStart := 0
+
+	if prefix != "" {
+		digitsStart = 2
+	}
+
+	isFloat := false
+	exponent := -1
+	digits := 0
+	invalid := -1
+
+	for i := digitsStart; i < len(body); i++ {
+		c := body[i]
+
+		switch {
+		case c == '_':
+			// checked below
+		case c == '.':
+			if isFloat || exponent != -1 {
+				return nil, literalErrorf(i, "unexpected '.' in number literal")
+			}
+
+			if base == 2 || base == 8 {
+				return nil, literalErrorf(i, "invalid radix point in %s literal", prefix)
+			}
+
+			isFloat = true
+		case base == 16 && lower(c) == 'p', base == 10 && lower(c) == 'e':
+			if exponent != -1 {
+				return nil, literalErrorf(i, "unexpected %q in number literal", c)
+			}
+
+			exponent = i
+			isFloat = true
+		case exponent != -1 && (c == '+' || c == '-') && i == exponent + 1:
+			// exponent sign
+		case exponent != -1:
+			if c < '0' || c > '9' {
+				return nil, literalErrorf(i, "invalid digit %q in exponent", c)
+			}
+		default:
+			if digitValue(c) >= base && invalid == -1 {
+				invalid = i
+			}
+
+			digits++
+		}
+	}
+
+	if prefix != "" && digits == 0 {
+		return nil, literalErrorf(0, "%s literal has no digits", prefix)
+	}
+
+	if exponent != -1 && strings.TrimLeft(body[exponent + 1:], "+-_") == "" {
+		return nil, literalErrorf(exponent, "exponent has no digits")
+	}
+
+	if base == 16 && isFloat && exponent == -1 {
+		return nil, literalErrorf(0, "hexadecimal mantissa requires a 'p' exponent")
+	}
+
+	if offset := badSeparator(body, base, digitsStart); offset != -1 {
+		return nil, literalErrorf(offset, "'_' must separate successive digits")
+	}
+
+	if invalid != -1 {
+		if prefix == "" {
+			prefix = "decimal"
+		}
+
+		return nil, literalErrorf(invalid, "invalid digit %q in %s literal", body[invalid], prefix)
+	}
+
+	clean := strings.Replace(body, "_", "", -1)
+
+	if !isFloat && !isImaginary {
+		// a leading 0 without prefix is the legacy octal form
+		if base == 10 && len(clean) > 1 && clean[0] == '0' {
+			for i := 1; i < len(clean); i++ {
+				if clean[i] > '7' {
+					return nil, literalErrorf(strings.IndexByte(body, clean[i]), "invalid digit %q in octal literal", clean[i])
+				}
+			}
+		}
+
+		value, ok := new(big.Int).SetString(clean, 0)
+
+		if !ok {
+			return nil, literalErrorf(0, "malformed integer literal %s", text)
+		}
+
+		return value, nil
+	}
+
+	if !isFloat && base == 10 {
+		// 0123i is a decimal imaginary literal, not an octal one
+		clean = strings.TrimLeft(clean, "0")
+
+		if clean == "" {
+			clean = "0"
+		}
+	}
+
+	value, _, err := big.ParseFloat(clean, 0, floatPrecision, big.ToNearestEven)
+
+	if err != nil {
+		return nil, literalErrorf(0, "malformed floating-point literal %s", text)
+	}
+
+	if isImaginary {
+		return imaginary{value}, nil
+	}
+
+	return value, nil
+}
+
+// badSeparator returns the offset of the first '_' in a number literal that
+// does not sit between two digits (or between the base prefix and a digit),
+// or -1 when all separators are well placed.
+func badSeparator(body string, base int, digitsStart int) int {
+	bound := 10
+
+	if base == 16 {
+		bound = 16
+	}
+
+	for i := 0; i < len(body); i++ {
+		if body[i] != '_' {
+			continue
+		}
+
+		before := i > 0 && (digitValue(body[i - 1]) < bound || i == digitsStart && digitsStart == 2)
+		after := i + 1 < len(body) && digitValue(body[i + 1]) < bound
+
+		if !before || !after {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// decodeString unquotes an interpreted or raw string literal.
+func decodeString(text string) (string, *literalError) {
+	if text[0] == '`' {
+		// carriage returns are discarded from raw strings
+		return strings.Replace(text[1:len(text) - 1], "\r", "", -1), nil
+	}
+
+	var b strings.Builder
+
+	for i := 1; i < len(text) - 1; {
+		if text[i] != '\\' {
+			r, width := utf8.DecodeRuneInString(text[i:])
+
+			if r == utf8.RuneError && width == 1 {
+				return "", literalErrorf(i, "invalid UTF-8 encoding")
+			}
+
+			b.WriteString(text[i:i + width])
+			i += width
+
+			continue
+		}
+
+		value, isByte, width, err := decodeEscape(text, i, '"')
+
+		if err != nil {
+			return "", err
+		}
+
+		if isByte {
+			b.WriteByte(byte(value))
+		} else {
+			b.WriteRune(value)
+		}
+
+		i += width
+	}
+
+	return b.String(), nil
+}
+
+// decodeRune returns the value of a rune literal.
+func decodeRune(text string) (rune, *literalError) {
+	body := text[1:len(text) - 1]
+
+	if body == "" {
+		return 0, literalErrorf(0, "empty rune literal or unescaped ' in rune literal")
+	}
+
+	var value rune
+	var width int
+
+	if body[0] == '\\' {
+		var err *literalError
+
+		value, _, width, err = decodeEscape(text, 1, '\'')
+
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		value, width = utf8.DecodeRuneInString(body)
+
+		if value == utf8.RuneError && width == 1 {
+			return 0, literalErrorf(1, "invalid UTF-8 encoding")
+		}
+	}
+
+	if 1 + width != len(text) - 1 {
+		return 0, literalErrorf(0, "more than one character in rune literal")
+	}
+
+	return value, nil
+}
+
+// decodeEscape decodes the escape sequence starting at text[i]. isByte is set
+// for octal and \x escapes, which denote a single byte rather than a rune.
+func decodeEscape(text string, i int, quote byte) (value rune, isByte bool, width int, err *literalError) {
+	if i + 1 >= len(text) - 1 {
+		return 0, false, 0, literalErrorf(i, "escape sequence not terminated")
+	}
+
+	c := text[i + 1]
+
+	switch c {
+	case 'a':
+		return '\a', false, 2, nil
+	case 'b':
+		return '\b', false, 2, nil
+	case 'f':
+		return '\f', false, 2, nil
+	case 'n':
+		return '\n', false, 2, nil
+	case 'r':
+		return '\r', false, 2, nil
+	case 't':
+		return '\t', false, 2, nil
+	case 'v':
+		return '\v', false, 2, nil
+	case '\\':
+		return '\\', false, 2, nil
+	case quote:
+		return rune(quote), false, 2, nil
+	}
+
+	var base, digits int
+	var max uint32
+
+	switch {
+	case '0' <= c && c <= '7':
+		base, digits, max = 8, 3, 255
+		width = 1
+	case c == 'x':
+		base, digits, max = 16, 2, 255
+		width = 2
+	case c == 'u':
+		base, digits, max = 16, 4, utf8.MaxRune
+		width = 2
+	case c == 'U':
+		base, digits, max = 16, 8, utf8.MaxRune
+		width = 2
+	default:
+		return 0, false, 0, literalErrorf(i, "unknown escape sequence \\%c", c)
+	}
+
+	var x uint32
+
+	for n := 0; n < digits; n++ {
+		at := i + width + n
+
+		if at >= len(text) - 1 {
+			return 0, false, 0, literalErrorf(i, "escape sequence not terminated")
+		}
+
+		d := digitValue(text[at])
+
+		if d >= base {
+			return 0, false, 0, literalErrorf(at, "invalid character %q in escape sequence", text[at])
+		}
+
+		x = x * uint32(base) + uint32(d)
+	}
+
+	width += digits
+
+	if x > max && base == 8 {
+		return 0, false, 0, literalErrorf(i, "octal escape value %d > 255", x)
+	}
+
+	if x > max || 0xD800 <= x && x < 0xE000 {
+		return 0, false, 0, literalErrorf(i, "escape sequence is invalid Unicode code point %#U", x)
+	}
+
+	return rune(x), c != 'u' && c != 'U', width, nil
+}
+
+func digitValue(c byte) int {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0')
+	case 'a' <= lower(c) && lower(c) <= 'f':
+		return int(lower(c) - 'a' + 10)
+	}
+
+	return 16
+}
+
+func lower(c byte) byte {
+	return c | ('x' - 'X')
+}
@@ -1,6 +1,11 @@
 package main
 
-import "testing"
+import (
+    "fmt"
+    "io/ioutil"
+    "strings"
+    "testing"
+)
 
 type testPairKey struct {
     string string
@@ -8,22 +13,22 @@ type testPairKey struct {
 }
 
 var tests = []testPairKey{
-    { "if i := 0 {\n}", []itemType{itemIf, itemSpace, itemIdentifier, itemDeclare, itemDeclare, itemSpace, itemNumber, itemSpace, itemLeftDelim, itemNewLine, itemRightDelim} },
+    { "if i := 0 {\n}", []itemType{itemIf, itemSpace, itemIdentifier, itemSpace, itemDeclare, itemSpace, itemNumber, itemSpace, itemLeftDelim, itemNewLine, itemRightDelim, itemSemiColon} },
     { "range", []itemType{itemRange} },
-    { "{####}", []itemType{itemLeftDelim, itemUnknownToken, itemRightDelim} },
-    { "{/*asdasd*/asdasd.Atoi()}", []itemType{itemLeftDelim, itemComment, itemIdentifier, itemFunction, itemLeftParen, itemRightParen, itemRightDelim} },
+    { "{####}", []itemType{itemLeftDelim, itemUnknownToken, itemRightDelim, itemSemiColon} },
+    { "{/*asdasd*/asdasd.Atoi()}", []itemType{itemLeftDelim, itemComment, itemIdentifier, itemFunction, itemLeftParen, itemRightParen, itemRightDelim, itemSemiColon} },
 }
 
 func TestKey(t *testing.T) {
     for pairNumber, pair := range tests {
-        lexer := lex(pair.string)
+        lexer := lex("", pair.string)
         i := 0
 
         for x := range lexer.items {
           if x.typ != pair.expectedKeys[i] {
               t.Error(
-                  "Expected", valuesTranslations[int(pair.expectedKeys[i])],
-                  "got", valuesTranslations[int(x.typ)],
+                  "Expected", valuesTranslations[pair.expectedKeys[i]],
+                  "got", valuesTranslations[x.typ],
                   "in pair", pairNumber + 1,
               )
           }
@@ -32,3 +37,230 @@ func TestKey(t *testing.T) {
         }
     }
 }
+
+func TestNextToken(t *testing.T) {
+    for pairNumber, pair := range tests {
+        lexer := newLexer("", pair.string)
+
+        for i, expected := range pair.expectedKeys {
+            if x := lexer.NextToken(); x.typ != expected {
+                t.Error(
+                    "Expected", valuesTranslations[expected],
+                    "got", valuesTranslations[x.typ],
+                    "at token", i + 1,
+                    "in pair", pairNumber + 1,
+                )
+            }
+        }
+
+        for i := 0; i < 2; i++ {
+            if x := lexer.NextToken(); x.typ != itemEOF {
+                t.Error("Expected itemEOF got", valuesTranslations[x.typ], "in pair", pairNumber + 1)
+            }
+        }
+    }
+}
+
+func largeSource(b *testing.B) string {
+    data, err := ioutil.ReadFile("testFiles/NOD.go")
+
+    if err != nil {
+        b.Fatal(err)
+    }
+
+    return strings.Repeat(string(data), 500)
+}
+
+func BenchmarkNextToken(b *testing.B) {
+    input := largeSource(b)
+    b.SetBytes(int64(len(input)))
+    b.ResetTimer()
+
+    for n := 0; n < b.N; n++ {
+        lexer := newLexer("", input)
+
+        for x := lexer.NextToken(); x.typ != itemEOF; x = lexer.NextToken() {
+        }
+    }
+}
+
+func BenchmarkLexChannel(b *testing.B) {
+    input := largeSource(b)
+    b.SetBytes(int64(len(input)))
+    b.ResetTimer()
+
+    for n := 0; n < b.N; n++ {
+        for range lex("", input).items {
+        }
+    }
+}
+
+var semicolonTests = []testPairKey{
+    { "x\ny", []itemType{itemIdentifier, itemSemiColon, itemIdentifier, itemSemiColon} },
+    { "return\n}\n", []itemType{itemReturn, itemSemiColon, itemRightDelim, itemSemiColon} },
+    { "f(a)\n", []itemType{itemIdentifier, itemLeftParen, itemIdentifier, itemRightParen, itemSemiColon} },
+    { "a[1]\ni++\n", []itemType{itemIdentifier, itemLeftBrack, itemNumber, itemRightBrack, itemSemiColon, itemIdentifier, itemDoublePlus, itemSemiColon} },
+    { "if x {\n", []itemType{itemIf, itemIdentifier, itemLeftDelim, itemNewLine} },
+    { "x + \ny", []itemType{itemIdentifier, itemPlus, itemNewLine, itemIdentifier, itemSemiColon} },
+    { "x // c\ny", []itemType{itemIdentifier, itemComment, itemSemiColon, itemIdentifier, itemSemiColon} },
+    { "x /* a\nb */ y", []itemType{itemIdentifier, itemSemiColon, itemComment, itemIdentifier, itemSemiColon} },
+    { "x\r\ny\r\n", []itemType{itemIdentifier, itemSemiColon, itemIdentifier, itemSemiColon} },
+    { "f(\n1,\n2,\n)\n", []itemType{itemIdentifier, itemLeftParen, itemNewLine, itemNumber, itemComma, itemNewLine, itemNumber, itemComma, itemNewLine, itemRightParen, itemSemiColon} },
+    { "func main ()\n", []itemType{itemFunctionDefine, itemFunctionName, itemLeftParen, itemRightParen, itemSemiColon} },
+}
+
+func TestSemicolonInsertion(t *testing.T) {
+    for pairNumber, pair := range semicolonTests {
+        lexer := newLexer("", pair.string)
+        got := []itemType{}
+
+        for x := lexer.NextToken(); x.typ != itemEOF; x = lexer.NextToken() {
+            if x.typ != itemSpace {
+                got = append(got, x.typ)
+            }
+        }
+
+        if len(got) != len(pair.expectedKeys) {
+            t.Error("Expected", len(pair.expectedKeys), "tokens got", len(got), "in pair", pairNumber + 1)
+            continue
+        }
+
+        for i := range got {
+            if got[i] != pair.expectedKeys[i] {
+                t.Error(
+                    "Expected", valuesTranslations[pair.expectedKeys[i]],
+                    "got", valuesTranslations[(got[i])],
+                    "at token", i + 1,
+                    "in pair", pairNumber + 1,
+                )
+            }
+        }
+    }
+}
+
+func TestOperators(t *testing.T) {
+    for spelling, expected := range operators {
+        lexer := newLexer("", "a " + spelling + " b")
+        lexer.NextToken()
+        lexer.NextToken()
+
+        if x := lexer.NextToken(); x.typ != expected || x.val != spelling {
+            t.Error("Expected", valuesTranslations[expected], "for", spelling, "got", valuesTranslations[x.typ], x.val)
+        }
+    }
+
+    lexer := newLexer("", "a&b<<=c...")
+    expected := []itemType{itemIdentifier, itemAmpersand, itemIdentifier, itemShiftLeftAssign, itemIdentifier, itemEllipsis}
+
+    for i, typ := range expected {
+        if x := lexer.NextToken(); x.typ != typ {
+            t.Error("Expected", valuesTranslations[typ], "got", valuesTranslations[x.typ], "at token", i + 1)
+        }
+    }
+}
+
+func TestKeywords(t *testing.T) {
+    if len(keyWords) != 25 {
+        t.Error("Expected 25 keywords got", len(keyWords))
+    }
+
+    for word, expected := range keyWords {
+        if x := newLexer("", word).NextToken(); x.typ != expected {
+            t.Error("Expected", valuesTranslations[expected], "for", word, "got", valuesTranslations[x.typ])
+        }
+    }
+
+    for _, word := range []string{"float64", "rune", "uint8", "error", "true", "nil", "len", "block", "template"} {
+        if x := newLexer("", word).NextToken(); x.typ != itemIdentifier {
+            t.Error("Expected itemIdentifier for", word, "got", valuesTranslations[x.typ])
+        }
+    }
+}
+
+type literalPair struct {
+    source string
+    expected string
+}
+
+var literalTests = []literalPair{
+    { "0x1F", "31" },
+    { "1_000", "1000" },
+    { "0o17", "15" },
+    { "017", "15" },
+    { "0b1010", "10" },
+    { "123456789012345678901234567890", "123456789012345678901234567890" },
+    { "1.5e3", "1500" },
+    { ".25", "0.25" },
+    { "0x1p-2", "0.25" },
+    { "0123i", "123i" },
+    { `"é"`, "é" },
+    { `"é\x41\101\n"`, "éAA\n" },
+    { "`a\\n`", `a\n` },
+    { `'\n'`, "10" },
+    { `'é'`, "233" },
+    { `'\''`, "39" },
+}
+
+var literalErrorTests = []literalPair{
+    { "0b102", "invalid digit '2' in binary literal" },
+    { "089", "invalid digit '8' in octal literal" },
+    { "1__0", "'_' must separate successive digits" },
+    { "0x", "hexadecimal literal has no digits" },
+    { "0x1.8", "hexadecimal mantissa requires a 'p' exponent" },
+    { "1e", "exponent has no digits" },
+    { `"\q"`, `unknown escape sequence \q` },
+    { `"\400"`, "octal escape value 256 > 255" },
+    { `'\U00110000'`, "escape sequence is invalid Unicode code point U+110000" },
+    { `'\uD800'`, "escape sequence is invalid Unicode code point U+D800" },
+    { `'ab'`, "more than one character in rune literal" },
+    { `''`, "empty rune literal or unescaped ' in rune literal" },
+    { `"\xZZ"`, "invalid character 'Z' in escape sequence" },
+}
+
+func TestLiteralValues(t *testing.T) {
+    for _, pair := range literalTests {
+        x := newLexer("", pair.source).NextToken()
+
+        if x.value == nil {
+            t.Error("Expected a value for", pair.source, "got", x)
+            continue
+        }
+
+        if got := fmt.Sprint(x.value); got != pair.expected {
+            t.Error("Expected", pair.expected, "for", pair.source, "got", got)
+        }
+    }
+
+    for _, pair := range literalErrorTests {
+        if x := newLexer("", pair.source).NextToken(); x.typ != itemError || x.val != pair.expected {
+            t.Error("Expected error", pair.expected, "for", pair.source, "got", x.val)
+        }
+    }
+}
+
+func TestPositions(t *testing.T) {
+    input := "/* a\nb */ x == y\n\tz"
+    lexer := newLexer("f.go", input)
+    expected := []string{"f.go:1:1", "f.go:2:6", "f.go:2:8", "f.go:2:11", "f.go:2:12", "f.go:3:2", "f.go:3:3"}
+    got := []string{}
+
+    for x := lexer.NextToken(); x.typ != itemEOF; x = lexer.NextToken() {
+        if x.typ != itemSpace {
+            got = append(got, lexer.file.Position(x.pos).String())
+        }
+    }
+
+    if strings.Join(got, " ") != strings.Join(expected, " ") {
+        t.Error("Expected", expected, "got", got)
+    }
+
+    if end := lexer.file.Position(Pos(len(input))); end.Line != 3 || end.Column != 3 {
+        t.Error("Expected end of file at 3:3 got", end)
+    }
+
+    lexer = newLexer("f.go", "'\\q'")
+
+    if x := lexer.NextToken(); lexer.file.Position(x.pos).Column != 2 {
+        t.Error("Expected the error at column 2 got", lexer.file.Position(x.pos))
+    }
+}
@@ -0,0 +1,69 @@
+package main
+
+// receiverBase returns the type name of a method receiver, T for both T and
+// *T, and whether the receiver is a pointer. The name is nil when the
+// receiver type is neither.
+func receiverBase(recv *Field) (*Ident, bool) {
+	typ, pointer := recv.Type, false
+
+	if star, ok := typ.(*StarExpr); ok {
+		typ, pointer = star.X, true
+	}
+
+	name, _ := typ.(*Ident)
+
+	return name, pointer
+}
+
+// addMethod records decl with the methods of its receiver base type. It
+// returns the method of the same name recorded before, in which case decl
+// is left out, or nil.
+func (f *File) addMethod(decl *FuncDecl) *FuncDecl {
+	base, _ := receiverBase(decl.Recv)
+
+	if base == nil {
+		return nil
+	}
+
+	for _, method := range f.Methods[base.Name] {
+		if method.Name.Name == decl.Name.Name && decl.Name.Name != "_" {
+			return method
+		}
+	}
+
+	if f.Methods == nil {
+		f.Methods = map[string][]*FuncDecl{}
+	}
+
+	f.Methods[base.Name] = append(f.Methods[base.Name], decl)
+
+	return nil
+}
+
+// collectMethods records the methods of f again from its declarations,
+// after the tree has been edited.
+func (f *File) collectMethods() {
+	f.Methods = nil
+
+	for _, decl := range f.Decls {
+		if method, ok := decl.(*FuncDecl); ok && method.Recv != nil {
+			f.addMethod(method)
+		}
+	}
+}
+
+// MethodSet returns the methods declared for the type name in source order.
+// The method set of T only holds the methods with a value receiver, the one
+// of *T, asked for with pointer, holds all of them. Whether a call is valid
+// on an addressable T is left to the caller.
+func (f *File) MethodSet(name string, pointer bool) []*FuncDecl {
+	var methods []*FuncDecl
+
+	for _, method := range f.Methods[name] {
+		if _, star := receiverBase(method.Recv); pointer || !star {
+			methods = append(methods, method)
+		}
+	}
+
+	return methods
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Position is a human readable source location.
+type Position struct {
+	Filename string
+	Offset   int // byte offset, starting at 0
+	Line     int // line number, starting at 1
+	Column   int // byte column on the line, starting at 1
+}
+
+func (p Position) String() string {
+	if p.Filename == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d", p.Filename, p.Line, p.Column)
+}
+
+// SourceFile is the line table of one source file. It turns the byte offsets
+// stored in tokens and AST nodes into positions.
+type SourceFile struct {
+	name  string
+	size  int
+	lines []int // offset of the first byte of every line
+}
+
+func newSourceFile(name string, input string) *SourceFile {
+	f := &SourceFile{name: name, size: len(input), lines: []int{0}}
+
+	for offset, r := range input {
+		if r == '\n' {
+			f.lines = append(f.lines, offset + 1)
+		}
+	}
+
+	return f
+}
+
+// Position returns the position of offset p. Offsets past the end of the
+// file are clamped to its end.
+func (f *SourceFile) Position(p Pos) Position {
+	offset := int(p)
+
+	if offset > f.size {
+		offset = f.size
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+
+	line := sort.Search(len(f.lines), func(i int) bool { return f.lines[i] > offset }) - 1
+
+	return Position{f.name, offset, line + 1, offset - f.lines[line] + 1}
+}
@@ -3,83 +3,108 @@ package main
 import (
     "fmt"
     "io/ioutil"
+    "math/big"
     "os"
-    "time"
 )
 
-var valuesTranslations = map[int]string{
+var valuesTranslations = map[itemType]string{
   -1: "program_head",
-  0: "itemError",
-  1: "itemBool",
-  2: "itemChar",
-  3: "itemCharConstant",
-  4: "itemAssign",
-  5: "itemDeclare",
-  6: "itemEOF",
-  7: "itemFunction",
-  8: "itemField" ,
-  9: "itemIdentifier",
-  10: "itemLeftDelim",
-  11: "itemLeftParen",
-  12: "itemNumber",
-  13: "itemPipe",
-  14: "itemRawString",
-  15: "itemRightDelim",
-  16: "itemRightParen",
-  17: "itemSpace",
-  18: "itemString",
-  19: "itemText",
-  20: "itemVariable",
-  21: "itemKeyword",
-  22: "itemBlock",
-  23: "itemDot",
-  24: "itemDefine",
-  25: "itemElse",
-  26: "itemEnd",
-  27: "itemIf",
-  28: "itemNil",
-  29: "itemRange",
-  30: "itemTemplate",
-  31: "itemWith",
-  32: "itemFor",
-  33: "itemDoublePlus",
-  34: "itemDoubleMinus",
-  35: "itemMinus",
-  36: "itemPlus",
-  37: "itemNewLine",
-  38: "itemPackage",
-  39: "itemPackageValue",
-  40: "itemImport",
-  41: "itemImportValue",
-  42: "itemFunctionDefine",
-  43: "itemNotEqual",
-  44: "itemFunctionName",
-  45: "itemVariableType",
-  46: "itemMap",
-  47: "itemVar",
-  48: "itemColon",
-  49: "itemByteType",
-  50: "itemStringType",
-  51: "itemIntType",
-  52: "itemUnknownToken",
-  53: "itemSemiColon",
-  54: "itemComment",
-  55: "itemNode",
-  56: "itemCalledLibrary",
-  57: "itemEqual",
-  58: "itemMupltiply",
-  59: "itemDivide",
-  60: "itemNot",
-  61: "itemGreater",
-  62: "itemLower",
-  63: "itemGreaterOrEqual",
-  64: "itemLowerOrEqual",
-  65: "itemOr",
-  66: "itemAnd",
-  67: "itemReturn",
-  68: "itemBoolType",
-  69: "itemIndex",
-  70: "itemRest",
+  itemError:            "itemError",
+  itemCharConstant:     "itemCharConstant",
+  itemEOF:              "itemEOF",
+  itemFunction:         "itemFunction",
+  itemField:            "itemField",
+  itemIdentifier:       "itemIdentifier",
+  itemNumber:           "itemNumber",
+  itemRawString:        "itemRawString",
+  itemSpace:            "itemSpace",
+  itemString:           "itemString",
+  itemText:             "itemText",
+  itemVariable:         "itemVariable",
+  itemNewLine:          "itemNewLine",
+  itemPackageValue:     "itemPackageValue",
+  itemImportValue:      "itemImportValue",
+  itemFunctionName:     "itemFunctionName",
+  itemVariableType:     "itemVariableType",
+  itemUnknownToken:     "itemUnknownToken",
+  itemComment:          "itemComment",
+  itemNode:             "itemNode",
+  itemCalledLibrary:    "itemCalledLibrary",
+  itemIndex:            "itemIndex",
+  itemPlus:             "itemPlus",
+  itemMinus:            "itemMinus",
+  itemMupltiply:        "itemMupltiply",
+  itemDivide:           "itemDivide",
+  itemRest:             "itemRest",
+  itemAmpersand:        "itemAmpersand",
+  itemPipe:             "itemPipe",
+  itemXor:              "itemXor",
+  itemShiftLeft:        "itemShiftLeft",
+  itemShiftRight:       "itemShiftRight",
+  itemAndNot:           "itemAndNot",
+  itemPlusAssign:       "itemPlusAssign",
+  itemMinusAssign:      "itemMinusAssign",
+  itemMultiplyAssign:   "itemMultiplyAssign",
+  itemDivideAssign:     "itemDivideAssign",
+  itemRestAssign:       "itemRestAssign",
+  itemAmpersandAssign:  "itemAmpersandAssign",
+  itemPipeAssign:       "itemPipeAssign",
+  itemXorAssign:        "itemXorAssign",
+  itemShiftLeftAssign:  "itemShiftLeftAssign",
+  itemShiftRightAssign: "itemShiftRightAssign",
+  itemAndNotAssign:     "itemAndNotAssign",
+  itemAnd:              "itemAnd",
+  itemOr:               "itemOr",
+  itemArrow:            "itemArrow",
+  itemDoublePlus:       "itemDoublePlus",
+  itemDoubleMinus:      "itemDoubleMinus",
+  itemEqual:            "itemEqual",
+  itemLower:            "itemLower",
+  itemGreater:          "itemGreater",
+  itemAssign:           "itemAssign",
+  itemNot:              "itemNot",
+  itemTilde:            "itemTilde",
+  itemNotEqual:         "itemNotEqual",
+  itemLowerOrEqual:     "itemLowerOrEqual",
+  itemGreaterOrEqual:   "itemGreaterOrEqual",
+  itemDeclare:          "itemDeclare",
+  itemEllipsis:         "itemEllipsis",
+  itemLeftParen:        "itemLeftParen",
+  itemLeftBrack:        "itemLeftBrack",
+  itemLeftDelim:        "itemLeftDelim",
+  itemComma:            "itemComma",
+  itemDot:              "itemDot",
+  itemRightParen:       "itemRightParen",
+  itemRightBrack:       "itemRightBrack",
+  itemRightDelim:       "itemRightDelim",
+  itemSemiColon:        "itemSemiColon",
+  itemColon:            "itemColon",
+  itemKeyword:          "itemKeyword",
+  itemBreak:            "itemBreak",
+  itemCase:             "itemCase",
+  itemChan:             "itemChan",
+  itemConst:            "itemConst",
+  itemContinue:         "itemContinue",
+  itemDefault:          "itemDefault",
+  itemDefer:            "itemDefer",
+  itemElse:             "itemElse",
+  itemFallthrough:      "itemFallthrough",
+  itemFor:              "itemFor",
+  itemFunctionDefine:   "itemFunctionDefine",
+  itemGo:               "itemGo",
+  itemGoto:             "itemGoto",
+  itemIf:               "itemIf",
+  itemImport:           "itemImport",
+  itemInterface:        "itemInterface",
+  itemMap:              "itemMap",
+  itemPackage:          "itemPackage",
+  itemRange:            "itemRange",
+  itemReturn:           "itemReturn",
+  itemSelect:           "itemSelect",
+  itemStruct:           "itemStruct",
+  itemSwitch:           "itemSwitch",
+  itemTypeDefine:       "itemTypeDefine",
+  itemVar:              "itemVar",
 }
 
 func main() {
@@ -91,1121 +116,3052 @@ func main() {
         return
     }
 
-    lexer := lex(string(data))
-    parse(lexer)
+    lexer := newLexer(filename, string(data))
+    tree, diagnostics := parse(lexer)
+
+    if len(diagnostics) > 0 {
+        for _, diagnostic := range diagnostics {
+            fmt.Println(diagnostic)
+        }
+
+        os.Exit(1)
+    }
+
+    printTree(tree)
 
     // for item := range lexer.items {
-    //     fmt.Println("value: ",item.val, "; ", valuesTranslations[int(item.typ)], "; position:", int(item.line), ":", int(item.pos))
+    //     fmt.Println("value: ",item.val, "; ", valuesTranslations[item.typ], "; position:", int(item.line), ":", int(item.pos))
     // }
 }
 
-func parse(lex *lexer) {
-  tree := &AstTree{
-    level: 0,
-    typ: -1,
-  }
+// parser holds the state of one parse.
+type parser struct {
+    lex *lexer
+    diagnostics DiagnosticList
+    scope *scope // innermost block being parsed
+
+    // exprLevel is -1 in the header of an if, for or switch statement,
+    // where T{ starts the body rather than a composite literal, and counts
+    // the open parentheses, brackets and braces of an expression otherwise
+    exprLevel int
+
+    // constants and types hold the values of the constants and the types
+    // of the type declarations seen so far, by declared name
+    constants map[*Ident]*Constant
+    types map[*Ident]Expr
 
-  token := getNextToken(lex, true)
+    function *closure // innermost function literal being parsed
+    syntaxLine int // line of the last syntax error, 0 before the first
+}
+
+// closure is a function literal being parsed, with the block of its
+// parameters.
+type closure struct {
+    outer *closure
+    literal *FuncLit
+    scope *scope
+}
+
+// bailout unwinds the parse of a statement or a declaration that has a
+// syntax error, see guard.
+type bailout struct {
+    token *item
+}
+
+// parse reads a whole file. Syntax errors do not stop it: every one of them
+// is returned, and the parts of the tree that could not be read are replaced
+// by BadDecl and BadStmt nodes.
+func parse(lex *lexer) (*File, DiagnosticList) {
+  p := &parser{lex: lex, scope: newScope(nil), constants: map[*Ident]*Constant{}, types: map[*Ident]Expr{}}
+  token := getNextToken(p)
 
-  token = parseProgram(tree, tree, token, lex, 1)
-  printTree(tree)
+  file, _ := parseProgram(token, p)
+  checkImplementations(file, p)
+  file.ids.number(file)
+  p.diagnostics.Sort()
+
+  return file, p.diagnostics
 }
 
 func debug(token *item) {
-    fmt.Println(valuesTranslations[int(token.typ)])
+    fmt.Println(valuesTranslations[token.typ])
     fmt.Println(token.val)
 }
 
+func newIdent(token *item) *Ident {
+    return &Ident{span: span{pos: token.pos, end: token.end}, Name: token.val}
+}
+
+func newBasicLit(token *item) *BasicLit {
+    return &BasicLit{span: span{pos: token.pos, end: token.end}, Kind: token.typ, Text: token.val, Value: token.value}
+}
+
+func parseProgram(token *item, p *parser) (*File, *item) {
+    file := &File{span: span{pos: 0, end: Pos(len(p.lex.input))}}
 
-func parseProgram(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ != itemPackage {
-        parseErrorPrint(token, itemPackage)
-    } else {
-        token = parsePackage(tree, node, token, lex, currentLevel)
+    token, _ = guard(p, synchronizeDeclaration, func() *item {
+        if token.typ != itemPackage {
+            parseError(p, token, itemPackage)
+        }
+
+        file.Package, token = parsePackage(token, p)
+
+        return token
+    })
+
+    for token.typ == itemImport {
+        start := token
+        failed := false
+
+        token, failed = guard(p, synchronizeDeclaration, func() *item {
+            file.Imports, token = parseImport(file.Imports, token, p)
+
+            return token
+        })
+
+        if failed {
+            file.Decls = append(file.Decls, &BadDecl{span{pos: start.pos, end: token.pos}})
+        }
     }
 
-    if token.typ != itemImport && token.typ != itemFunctionDefine {
-        //syntax error: non-declaration statement outside function body
-        parseErrorPrint(token, itemFunctionDefine)
+    // expect at least main()
+    return file, parseFunctionsList(file, token, p)
+}
+
+// parseImport reads an import declaration, either a single import or a
+// parenthesized list of them.
+func parseImport(imports []*ImportSpec, token *item, p *parser) ([]*ImportSpec, *item) {
+    token = getNextToken(p)
+
+    if token.typ != itemLeftParen {
+        spec, token := parseImportSpec(token, p)
+
+        return append(imports, spec), parseSemiColon(token, p)
     }
 
-    if token.typ == itemImport {
-        token = parseImport(tree, node, token, lex, currentLevel)
+    token = getNextToken(p)
+
+    if token.typ != itemRightParen {
+        imports, token = parseImportsValue(imports, token, p)
     }
 
-    if token.typ == itemFunctionDefine {
-        token = parseFunctionsList(tree, node, token, lex, currentLevel)
-    } else {
-        // expect at least main()
-        parseErrorPrint(token, itemFunctionDefine)
+    if token.typ != itemRightParen {
+        parseError(p, token, itemRightParen)
     }
 
-    return token
+    return imports, parseSemiColon(getNextToken(p), p)
 }
 
-func parseImport(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    packageNode := node.addChild(&AstTree{
-        key: time.Now().String(),
-        typ: itemNode,
-        level: currentLevel,
-        text: "Import definition",
-    })
+func parseImportsValue(imports []*ImportSpec, token *item, p *parser) ([]*ImportSpec, *item) {
+    spec, token := parseImportSpec(token, p)
+    imports = append(imports, spec)
 
-    token = getNextToken(lex, false)
+    token = parseSemiColon(token, p)
 
-    if token.val == "(" && token.typ == itemLeftParen {
-        libsNode := packageNode.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNode,
-                level: currentLevel + 2,
-                text: "Imported libs",
-        })
+    if token.typ == itemRightParen {
+        return imports, token
+    }
 
-        token = getNextToken(lex, true)
+    return parseImportsValue(imports, token, p)
+}
 
-        token = parseImportsValue(tree, libsNode, token, lex, currentLevel + 4)
+// parseImportSpec reads one import path with its optional name: an alias,
+// "." or "_".
+func parseImportSpec(token *item, p *parser) (*ImportSpec, *item) {
+    spec := &ImportSpec{span: span{pos: token.pos}}
 
-        if token.typ != itemRightParen {
-            parseErrorPrint(token, itemRightParen)
-        }
+    if token.typ == itemIdentifier || token.typ == itemDot {
+        spec.Name = newIdent(token)
+        token = getNextToken(p)
+    }
 
-        token = getNextToken(lex, true)
-    } else {
-        parseErrorPrint(token, itemLeftParen)
+    if token.typ != itemString && token.typ != itemRawString {
+        parseError(p, token, itemString)
+    }
+
+    spec.Path = newBasicLit(token)
+    spec.end = token.end
+
+    return spec, getNextToken(p)
+}
+
+func parsePackage(token *item, p *parser) (*Ident, *item) {
+    token = getNextToken(p)
+
+    if token.typ != itemPackageValue {
+        parseError(p, token, itemPackageValue)
+    }
+
+    name := newIdent(token)
+
+    return name, parseSemiColon(getNextToken(p), p)
+}
+
+func parseFunction(decl *FuncDecl, token *item, p *parser) *item {
+    decl.Name = newIdent(token)
+
+    token = getNextToken(p)
+
+    if token.typ != itemLeftParen {
+        parseError(p, token, itemLeftParen)
+    }
+
+    decl.Params, token = parseParameters(getNextToken(p), true, p)
+    decl.Results, token = parseResults(getNextToken(p), p)
+
+    // parameters and results belong to the outermost block of the body
+    openScope(p)
+
+    if decl.Recv != nil {
+        declareFields([]*Field{decl.Recv}, p)
     }
 
+    declareFields(decl.Params, p)
+    declareFields(decl.Results, p)
+
+    decl.Body, token = parseBlock(token, p)
+    decl.end = decl.Body.end
+
+    closeScope(p)
+    checkBody(decl.Body, p)
+
     return token
 }
 
-func parseImportsValue(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ == itemString {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemString,
-                level: currentLevel,
-                text: "Lib",
-                data: token.val,
-        })
+func declareFields(fields []*Field, p *parser) {
+    for _, field := range fields {
+        for _, name := range field.Names {
+            p.scope.declare(name)
+        }
+    }
+}
+
+func openScope(p *parser) {
+    p.scope = newScope(p.scope)
+}
+
+func closeScope(p *parser) {
+    p.scope = p.scope.outer
+}
+
+//main parse function
+func parseFunctionsList(file *File, token *item, p *parser) *item {
+    if token.typ == itemEOF {
+        return token
+    }
 
-        token = getNextToken(lex, false)
+    start := token
+    var decl Decl
 
-        if token.typ != itemNewLine && token.typ != itemRightParen {
-            parseErrorPrint(token, itemRightParen)
+    p.exprLevel = 0
+
+    token, failed := guard(p, synchronizeDeclaration, func() *item {
+        decl, token = parseTopLevelDeclaration(token, p)
+
+        return token
+    })
+
+    if failed {
+        decl = &BadDecl{span{pos: start.pos, end: token.pos}}
+    }
+
+    if method, ok := decl.(*FuncDecl); ok && method.Recv != nil {
+        if previous := file.addMethod(method); previous != nil {
+            base, _ := receiverBase(method.Recv)
+
+            reportError(p, method.Name.pos, fmt.Sprintf("method %s.%s already declared at %s", base.Name, method.Name.Name, p.lex.file.Position(previous.Name.pos)))
         }
+    }
 
-        if token.typ == itemRightParen {
-            return token
+    file.Decls = append(file.Decls, decl)
+
+    return parseFunctionsList(file, token, p)
+}
+
+// parseTopLevelDeclaration reads a function, const, type or var
+// declaration.
+func parseTopLevelDeclaration(token *item, p *parser) (Decl, *item) {
+    switch token.typ {
+    case itemConst, itemTypeDefine, itemVar:
+        decl, token := parseDeclaration(token, p)
+
+        return decl, parseSemiColon(token, p)
+    }
+
+    return parseFunctionDeclaration(token, p)
+}
+
+func parseFunctionDeclaration(token *item, p *parser) (*FuncDecl, *item) {
+    if token.typ != itemFunctionDefine {
+        parseError(p, token, itemFunctionDefine)
+    }
+
+    decl := &FuncDecl{span: span{pos: token.pos}}
+
+    token = getNextToken(p)
+
+    if token.typ == itemLeftParen {
+        decl.Recv, token = parseReceiver(token, p)
+
+        // the lexer only knows a function name right after func
+        if token.typ == itemIdentifier {
+            token.typ = itemFunctionName
         }
+    }
 
-        token = getNextToken(lex, false)
+    if token.typ != itemFunctionName {
+        parseError(p, token, itemFunctionName)
+    }
 
-        if token.typ == itemRightParen {
-            return token
+    token = parseFunction(decl, token, p)
+
+    return decl, parseSemiColon(token, p)
+}
+
+// parseReceiver reads the receiver of a method, from the "(" in token, and
+// returns the token following its ")". The receiver is a single parameter
+// whose type is a type name T or a pointer *T.
+func parseReceiver(token *item, p *parser) (*Field, *item) {
+    start := token
+    fields, token := parseParameters(getNextToken(p), false, p)
+
+    if token.typ != itemRightParen {
+        parseError(p, token, itemRightParen)
+    }
+
+    count := 0
+
+    for _, field := range fields {
+        count += len(field.Names)
+
+        if len(field.Names) == 0 {
+            count++
         }
+    }
+
+    switch {
+    case count == 0:
+        reportError(p, start.pos, "method has no receiver")
+
+        return nil, getNextToken(p)
+    case count > 1:
+        reportError(p, start.pos, "method has multiple receivers")
+    }
+
+    recv := fields[0]
+
+    if base, _ := receiverBase(recv); base == nil {
+        reportError(p, recv.Type.Pos(), fmt.Sprintf("invalid receiver type %s", p.lex.input[recv.Type.Pos():recv.Type.End()]))
+    }
+
+    return recv, getNextToken(p)
+}
+
+// parameter is one entry of a parameter list before grouping: a name, a
+// type, or a name followed by a type.
+type parameter struct {
+    name *Ident
+    typ  Expr
+}
 
-        if token.typ == itemString {
-            token = parseImportsValue(tree, node, token, lex, currentLevel)
+// parseParameters reads the parameters up to the closing ")", which is
+// returned. Like in Go, either every parameter has a name, as in
+// (a, b int, c string), or none of them has one, as in (int, string).
+// A variadic ...T is only accepted as the last parameter, when variadic is
+// set.
+func parseParameters(token *item, variadic bool, p *parser) ([]*Field, *item) {
+    var list []parameter
+    named := false
+
+    for startsType(token) {
+        var entry parameter
+
+        // a name, or the name of a type, which is only known once the
+        // whole list is read: the list is named if an entry is a name
+        // followed by a type
+        if token.typ == itemIdentifier {
+            entry.name = newIdent(token)
+            token = getNextToken(p)
+
+            if token.typ == itemField {
+                // not a name but the package of a qualified type name
+                entry.typ, token = parseTypeName(entry.name, token, p)
+                entry.name = nil
+            } else if token.typ != itemComma && token.typ != itemRightParen {
+                entry.typ, token = parseParameterType(token, variadic, p)
+                named = true
+            }
         } else {
-            parseErrorPrint(token, itemString)
+            entry.typ, token = parseParameterType(token, variadic, p)
+        }
+
+        list = append(list, entry)
+
+        if token.typ != itemComma {
+            break
         }
+
+        token = getNextToken(p)
+    }
+
+    if token.typ != itemRightParen {
+        parseError(p, token, itemRightParen)
+    }
+
+    var fields []*Field
+
+    if named {
+        fields = groupParameters(list, token, p)
     } else {
-        parseErrorPrint(token, itemString)
+        for _, entry := range list {
+            if entry.typ == nil {
+                // a lone name is the name of a type
+                entry.typ = entry.name
+            }
+
+            fields = append(fields, &Field{span: span{pos: entry.typ.Pos(), end: entry.typ.End()}, Type: entry.typ})
+        }
     }
 
-    return token
+    for i, field := range fields {
+        if _, ok := field.Type.(*Ellipsis); ok && i != len(fields) - 1 {
+            reportError(p, field.Type.Pos(), "can only use ... with final parameter in list")
+        }
+    }
+
+    return fields, token
 }
 
-func parsePackage(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    packageNode := node.addChild(&AstTree{
-        key: time.Now().String(),
-        typ: itemNode,
-        level: currentLevel,
-        text: "Package definition",
-    })
+// groupParameters gives to every run of names the type that follows it.
+func groupParameters(list []parameter, closing *item, p *parser) []*Field {
+    var fields []*Field
+    var names []*Ident
 
-    token = getNextToken(lex, false)
+    for _, entry := range list {
+        if entry.name == nil {
+            reportError(p, entry.typ.Pos(), "mixed named and unnamed parameters")
 
-    if token.typ == itemPackageValue {
-        packageNode.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemPackageValue,
-            level: currentLevel + 2,
-            text: "itemPackageValue",
-            data: token.val,
-        })
+            continue
+        }
 
-        token = getNextToken(lex, true)
-    } else {
-        parseErrorPrint(token, itemPackageValue)
+        names = append(names, entry.name)
+
+        if entry.typ != nil {
+            fields = append(fields, &Field{span: span{pos: names[0].pos, end: entry.typ.End()}, Names: names, Type: entry.typ})
+            names = nil
+        }
     }
 
-    return token
+    if len(names) > 0 {
+        parseError(p, closing, itemVariableType)
+    }
+
+    return fields
 }
 
-func parseFunction(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    node.addChild(&AstTree{
-        key: time.Now().String(),
-        typ: itemFunctionName,
-        level: currentLevel,
-        text: "Function name",
-        data: token.val,
-    })
+// startsType reports whether token can begin a type or a parameter.
+func startsType(token *item) bool {
+    switch token.typ {
+    case itemIdentifier, itemLeftBrack, itemEllipsis, itemMupltiply, itemMap, itemStruct, itemInterface, itemFunctionDefine:
+        return true
+    }
+
+    return false
+}
+
+func parseParameterType(token *item, variadic bool, p *parser) (Expr, *item) {
+    if token.typ == itemEllipsis && variadic {
+        ellipsis := &Ellipsis{span: span{pos: token.pos}}
 
-    isMain := false
+        ellipsis.Elt, token = parseType(getNextToken(p), p)
+        ellipsis.end = ellipsis.Elt.End()
 
-    if token.val == "main" {
-        isMain = true
+        return ellipsis, token
     }
 
-    token = getNextToken(lex, false)
+    return parseType(token, p)
+}
 
-    if token.val == "(" && token.typ == itemLeftParen {
-        parametersNode := node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNode,
-                level: currentLevel,
-                text: "Parameters of function",
-        })
+// parseResults reads the result types of a function, if any: a single type
+// or a parenthesized list that may name the results.
+func parseResults(token *item, p *parser) ([]*Field, *item) {
+    if token.typ == itemLeftDelim || token.typ != itemLeftParen && !startsType(token) {
+        return nil, token
+    }
+
+    if token.typ == itemLeftParen {
+        var results []*Field
+
+        results, token = parseParameters(getNextToken(p), false, p)
+
+        return results, getNextToken(p)
+    }
+
+    result, token := parseType(token, p)
+
+    return []*Field{{span: span{pos: result.Pos(), end: result.End()}, Type: result}}, token
+}
+
+// parseFuncType reads the signature of a function type or literal, from
+// the func keyword in token.
+func parseFuncType(token *item, p *parser) (*FuncType, *item) {
+    typ := &FuncType{span: span{pos: token.pos}}
+
+    return parseSignature(typ, getNextToken(p), p)
+}
+
+// parseSignature reads the parameters, from the "(" in token, and the
+// results of typ.
+func parseSignature(typ *FuncType, token *item, p *parser) (*FuncType, *item) {
+    if token.typ != itemLeftParen {
+        parseError(p, token, itemLeftParen)
+    }
+
+    typ.Params, token = parseParameters(getNextToken(p), true, p)
+    typ.end = token.end
+    typ.Results, token = parseResults(getNextToken(p), p)
+
+    if len(typ.Results) > 0 {
+        typ.end = typ.Results[len(typ.Results) - 1].End()
+    }
+
+    return typ, token
+}
+
+// parseFuncLit reads the body, from the "{" in token, of a function literal
+// with the signature typ. The body is checked on its own, like the one of a
+// function declaration.
+func parseFuncLit(typ *FuncType, token *item, p *parser) (*FuncLit, *item) {
+    literal := &FuncLit{span: span{pos: typ.pos}, Type: typ}
+
+    openScope(p)
+    p.function = &closure{outer: p.function, literal: literal, scope: p.scope}
+    declareFields(typ.Params, p)
+    declareFields(typ.Results, p)
+
+    literal.Body, token = parseBlock(token, p)
+    literal.end = literal.Body.end
+
+    p.function = p.function.outer
+    closeScope(p)
+    checkBody(literal.Body, p)
+
+    return literal, token
+}
+
+// resolve records the variable ident refers to as a free variable of the
+// function literals being parsed that it is declared outside of. Package
+// level names, constants and types are not captured.
+func resolve(ident *Ident, p *parser) {
+    declared := p.scope
+
+    for declared != nil && declared.lookupLocal(ident.Name) == nil {
+        declared = declared.outer
+    }
+
+    if p.function == nil || declared == nil || declared.outer == nil {
+        return
+    }
+
+    declaration := declared.lookupLocal(ident.Name)
+    _, isConstant := p.constants[declaration]
+    _, isType := p.types[declaration]
+
+    if isConstant || isType {
+        return
+    }
 
-        token = getNextToken(lex, false)
+    for function := p.function; function != nil && !declared.within(function.scope); function = function.outer {
+        function.literal.capture(declaration)
+    }
+}
 
-        if token.typ == itemIdentifier && isMain == false {
-            token = parseParameters(tree, parametersNode, token, lex, currentLevel + 2)
+// parseType reads a type: a type name, possibly qualified by a package
+// name, an array, slice, map, pointer, struct, interface or function type.
+func parseType(token *item, p *parser) (Expr, *item) {
+    switch token.typ {
+    case itemIdentifier:
+        return parseTypeName(newIdent(token), getNextToken(p), p)
+    case itemStruct:
+        return parseStructType(token, p)
+    case itemInterface:
+        return parseInterfaceType(token, p)
+    case itemFunctionDefine:
+        return parseFuncType(token, p)
+    case itemMap:
+        return parseMapType(token, p)
+    case itemMupltiply:
+        pointer := &StarExpr{span: span{pos: token.pos}}
+
+        pointer.X, token = parseType(getNextToken(p), p)
+        pointer.end = pointer.X.End()
+
+        return pointer, token
+    case itemLeftBrack:
+        array, token := parseArrayType(token, p)
+
+        if _, ok := array.Len.(*Ellipsis); ok {
+            reportError(p, array.pos, "invalid use of [...] array (outside a composite literal)")
         }
 
-        if token.typ != itemRightParen {
-            parseErrorPrint(token, itemRightParen)
+        return array, token
+    }
+
+    parseError(p, token, itemVariableType)
+
+    return nil, token
+}
+
+// parseArrayType reads [N]T, the slice type []T, or [...]T whose length is
+// the number of elements of its composite literal. The length is nil for a
+// slice type and an *Ellipsis for [...]T.
+func parseArrayType(token *item, p *parser) (*ArrayType, *item) {
+    array := &ArrayType{span: span{pos: token.pos}}
+
+    token = getNextToken(p)
+
+    if token.typ == itemEllipsis {
+        array.Len = &Ellipsis{span: span{pos: token.pos, end: token.end}}
+        token = getNextToken(p)
+    } else if token.typ != itemRightBrack {
+        p.exprLevel++
+        array.Len, token = parseExpression(token, p)
+        p.exprLevel--
+    }
+
+    if token.typ != itemRightBrack {
+        parseError(p, token, itemRightBrack)
+    }
+
+    array.Elt, token = parseType(getNextToken(p), p)
+    array.end = array.Elt.End()
+
+    return array, token
+}
+
+// parseMapType reads map[K]V.
+func parseMapType(token *item, p *parser) (*MapType, *item) {
+    mapType := &MapType{span: span{pos: token.pos}}
+
+    token = getNextToken(p)
+
+    if token.typ != itemLeftBrack {
+        parseError(p, token, itemLeftBrack)
+    }
+
+    mapType.Key, token = parseType(getNextToken(p), p)
+
+    if token.typ != itemRightBrack {
+        parseError(p, token, itemRightBrack)
+    }
+
+    mapType.Value, token = parseType(getNextToken(p), p)
+    mapType.end = mapType.Value.End()
+
+    return mapType, token
+}
+
+// parseTypeName reads what follows the identifier name of a type name, that
+// is the type of pkg.T when name is a package name.
+func parseTypeName(name *Ident, token *item, p *parser) (Expr, *item) {
+    if token.typ != itemField {
+        return name, token
+    }
+
+    selector := &SelectorExpr{span: span{pos: name.pos, end: token.end}, X: name}
+    selector.Sel = &Ident{span: span{pos: token.pos + 1, end: token.end}, Name: token.val[1:]}
+
+    return selector, getNextToken(p)
+}
+
+// parseStructType reads struct { fields }.
+func parseStructType(token *item, p *parser) (*StructType, *item) {
+    structure := &StructType{span: span{pos: token.pos}}
+
+    token = getNextToken(p)
+
+    if token.typ != itemLeftDelim {
+        parseError(p, token, itemLeftDelim)
+    }
+
+    token = getNextToken(p)
+
+    for token.typ == itemIdentifier || token.typ == itemMupltiply {
+        var field *Field
+
+        field, token = parseFieldDeclaration(token, p)
+        structure.Fields = append(structure.Fields, field)
+
+        // the semicolon may be left out before "}"
+        if token.typ != itemSemiColon {
+            break
         }
 
-        token = getNextToken(lex, false)
+        token = getNextToken(p)
+    }
+
+    if token.typ != itemRightDelim {
+        parseError(p, token, itemRightDelim)
+    }
+
+    structure.end = token.end
+
+    return structure, getNextToken(p)
+}
+
+// parseInterfaceType reads interface { Elements }. Every element is a
+// method, an embedded interface or, in a constraint, a union of type terms
+// such as ~int | string.
+func parseInterfaceType(token *item, p *parser) (*InterfaceType, *item) {
+    iface := &InterfaceType{span: span{pos: token.pos}}
+    methods := map[string]bool{}
+
+    token = getNextToken(p)
+
+    if token.typ != itemLeftDelim {
+        parseError(p, token, itemLeftDelim)
+    }
+
+    token = getNextToken(p)
 
-        if token.typ == itemLeftDelim {
-            bodyNode := node.addChild(&AstTree{
-                    key: time.Now().String(),
-                    typ: itemNode,
-                    level: currentLevel,
-                    text: "Body of function",
-            })
+    for token.typ == itemTilde || startsType(token) {
+        var element *Field
 
-            token = getNextToken(lex, true)
+        element, token = parseInterfaceElement(token, p)
+        iface.Methods = append(iface.Methods, element)
 
-            token = parseInstructionList(tree, bodyNode, token, lex, currentLevel + 2)
+        if len(element.Names) > 0 {
+            name := element.Names[0].Name
 
-            if token.typ != itemRightDelim {
-                parseErrorPrint(token, itemRightDelim)
+            if methods[name] {
+                reportError(p, element.pos, fmt.Sprintf("duplicate method %s", name))
             }
-        } else {
-            parseErrorPrint(token, itemLeftDelim)
+
+            methods[name] = true
         }
-    } else {
-        parseErrorPrint(token, itemLeftParen)
+
+        // the semicolon may be left out before "}"
+        if token.typ != itemSemiColon {
+            break
+        }
+
+        token = getNextToken(p)
+    }
+
+    if token.typ != itemRightDelim {
+        parseError(p, token, itemRightDelim)
     }
 
-    return getNextToken(lex, false)
+    iface.end = token.end
+
+    return iface, getNextToken(p)
 }
 
-//main parse function
-func parseFunctionsList(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ == itemError {
-        return token
-    }
+func parseInterfaceElement(token *item, p *parser) (*Field, *item) {
+    element := &Field{span: span{pos: token.pos}}
+    var term Expr
 
-    if token.typ == itemFunctionDefine {
-        functionNode := node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemNode,
-            level: currentLevel,
-            text: "Function",
-        })
+    if token.typ == itemIdentifier {
+        name := newIdent(token)
+
+        token = getNextToken(p)
+
+        if token.typ == itemLeftParen {
+            method := &FuncType{span: span{pos: token.pos}}
+
+            element.Names = []*Ident{name}
+            element.Type, token = parseSignature(method, token, p)
+            element.end = method.end
+
+            return element, token
+        }
+
+        term, token = parseTypeName(name, token, p)
+    } else {
+        term, token = parseTypeTerm(token, p)
+    }
+
+    for token.typ == itemPipe {
+        var y Expr
+
+        y, token = parseTypeTerm(getNextToken(p), p)
+        term = newBinary(term, itemPipe, y)
+    }
+
+    element.Type = term
+    element.end = term.End()
+
+    return element, token
+}
+
+// parseTypeTerm reads a type, or ~T for all the types with the underlying
+// type T.
+func parseTypeTerm(token *item, p *parser) (Expr, *item) {
+    if token.typ != itemTilde {
+        return parseType(token, p)
+    }
+
+    tilde := &UnaryExpr{span: span{pos: token.pos}, Op: itemTilde}
+
+    tilde.X, token = parseType(getNextToken(p), p)
+    tilde.end = tilde.X.End()
+
+    return tilde, token
+}
+
+// parseFieldDeclaration reads the fields of a struct declared on one line:
+// a list of names with their type, or an embedded type. Both can be
+// followed by a tag.
+func parseFieldDeclaration(token *item, p *parser) (*Field, *item) {
+    field := &Field{span: span{pos: token.pos}}
+
+    if token.typ == itemMupltiply {
+        // an embedded pointer type
+        pointer := &StarExpr{span: span{pos: token.pos}}
+
+        token = getNextToken(p)
+
+        if token.typ != itemIdentifier {
+            parseError(p, token, itemIdentifier)
+        }
+
+        pointer.X, token = parseTypeName(newIdent(token), getNextToken(p), p)
+        pointer.end = pointer.X.End()
+
+        return finishField(field, pointer, token, p)
+    }
+
+    name := newIdent(token)
+
+    token = getNextToken(p)
+
+    switch token.typ {
+    case itemSemiColon, itemRightDelim, itemString, itemRawString, itemField:
+        field.Type, token = parseTypeName(name, token, p)
+    default:
+        field.Names = []*Ident{name}
+
+        for token.typ == itemComma {
+            token = getNextToken(p)
+
+            if token.typ != itemIdentifier {
+                parseError(p, token, itemIdentifier)
+            }
+
+            field.Names = append(field.Names, newIdent(token))
+            token = getNextToken(p)
+        }
+
+        field.Type, token = parseType(token, p)
+    }
+
+    return finishField(field, field.Type, token, p)
+}
+
+// finishField sets the type of a struct field and reads its tag, if any.
+func finishField(field *Field, typ Expr, token *item, p *parser) (*Field, *item) {
+    field.Type = typ
+    field.end = typ.End()
+
+    if token.typ == itemString || token.typ == itemRawString {
+        field.Tag = newBasicLit(token)
+        field.end = token.end
+        token = getNextToken(p)
+    }
+
+    return field, token
+}
+
+// parseBody reads a braced statement list that is a block of its own and
+// returns the token after "}".
+func parseBody(token *item, p *parser) (*BlockStmt, *item) {
+    openScope(p)
+    body, token := parseBlock(token, p)
+    closeScope(p)
+
+    return body, token
+}
+
+// parseBlock reads a braced statement list whose declarations go to the
+// current scope.
+func parseBlock(token *item, p *parser) (*BlockStmt, *item) {
+    if token.typ != itemLeftDelim {
+        parseError(p, token, itemLeftDelim)
+    }
+
+    body := &BlockStmt{span: span{pos: token.pos}}
+    outer := p.exprLevel
+
+    token = parseInstructionList(body, getNextToken(p), p)
+
+    if token.typ != itemRightDelim {
+        parseError(p, token, itemRightDelim)
+    }
+
+    body.end = token.end
+    p.exprLevel = outer
+
+    return body, getNextToken(p)
+}
+
+//main parse function
+func parseInstructionList(body *BlockStmt, token *item, p *parser) *item {
+    // case and default end the statements of a switch clause
+    if token.typ == itemRightDelim || token.typ == itemEOF || token.typ == itemCase || token.typ == itemDefault {
+        return token
+    }
+
+    if token.typ == itemSemiColon {
+        // empty statement
+        return parseInstructionList(body, getNextToken(p), p)
+    }
+
+    start := token
+    var instruction Stmt
+
+    p.exprLevel = 0
+
+    token, failed := guard(p, synchronizeInstruction, func() *item {
+        instruction, token = parseInstruction(token, p)
+
+        if token.typ != itemSemiColon && token.typ != itemRightDelim {
+            parseError(p, token, itemSemiColon)
+        }
+
+        return token
+    })
+
+    if failed {
+        instruction = &BadStmt{span{pos: start.pos, end: token.pos}}
+    }
+
+    body.List = append(body.List, instruction)
+
+    if token.typ == itemSemiColon {
+        token = getNextToken(p)
+    }
+
+    return parseInstructionList(body, token, p)
+}
+
+// parseDefer reads defer f(x). Only calls can be deferred, and not the ones
+// to builtins that have a result, which would be lost.
+func parseDefer(token *item, p *parser) (Stmt, *item) {
+    start := token
+    token = getNextToken(p)
+
+    var x Expr
+
+    if token.typ == itemLeftParen {
+        // (f)() defers a call, (f()) is rejected like in Go
+        open := token
+
+        p.exprLevel++
+        x, token = parseExpression(getNextToken(p), p)
+        p.exprLevel--
+
+        if token.typ != itemRightParen {
+            parseError(p, token, itemRightParen)
+        }
+
+        inner := x
+        x, token = parseExtendedFactor(x, getNextToken(p), p)
+        x, token = parseBinaryOperators(1, x, token, p)
+
+        if _, ok := x.(*CallExpr); ok && x == inner {
+            reportError(p, open.pos, "expression in defer must not be parenthesized")
+        }
+    } else {
+        x, token = parseExpression(token, p)
+    }
+
+    call, ok := x.(*CallExpr)
+
+    if !ok {
+        reportError(p, x.Pos(), "expression in defer must be function call")
+
+        return &BadStmt{span{pos: start.pos, end: x.End()}}, token
+    }
+
+    if name, ok := call.Fun.(*Ident); ok && p.scope.lookup(name.Name) == nil {
+        switch predeclared[name.Name] {
+        case predeclaredType:
+            reportError(p, call.pos, "defer requires function call, not conversion")
+        case predeclaredFunction:
+            if !statementBuiltins[name.Name] {
+                reportError(p, call.pos, fmt.Sprintf("defer discards result of %s", p.lex.input[call.pos:call.end]))
+            }
+        }
+    }
+
+    return &DeferStmt{span: span{pos: start.pos, end: call.end}, Call: call}, token
+}
+
+// statementBuiltins holds the builtins that can be called as a statement
+// or deferred: the ones without a result, and copy and recover, whose
+// result may be discarded.
+var statementBuiltins = map[string]bool{
+    "clear":   true,
+    "close":   true,
+    "copy":    true,
+    "delete":  true,
+    "panic":   true,
+    "print":   true,
+    "println": true,
+    "recover": true,
+}
+
+func parseInstruction(token *item, p *parser) (Stmt, *item) {
+    if token.typ == itemReturn {
+        instruction := &ReturnStmt{span: span{pos: token.pos, end: token.end}}
+
+        token = getNextToken(p)
+
+        // a bare return, the function has no results or named ones
+        if token.typ == itemSemiColon || token.typ == itemRightDelim {
+            return instruction, token
+        }
+
+        instruction.Results, token = parseExpressions(nil, token, p)
+        instruction.end = instruction.Results[len(instruction.Results) - 1].End()
+
+        return instruction, token
+    }
+
+    if token.typ == itemConst || token.typ == itemTypeDefine || token.typ == itemVar {
+        return parseDeclaration(token, p)
+    }
+
+    if token.typ == itemDefer {
+        return parseDefer(token, p)
+    }
+
+    if startsExpression(token) {
+        instruction, token := parseInstructionExpression(token, false, p)
+
+        if token.typ == itemColon {
+            return parseLabeledStatement(instruction, token, p)
+        }
+
+        return instruction, token
+    }
+
+    if token.typ == itemIf {
+        return parseIf(token, p)
+    }
+
+    if token.typ == itemLeftDelim {
+        return parseBody(token, p)
+    }
+
+    if token.typ == itemSwitch {
+        return parseSwitch(token, p)
+    }
+
+    if token.typ == itemBreak || token.typ == itemContinue || token.typ == itemGoto || token.typ == itemFallthrough {
+        return parseBranch(token, p)
+    }
+
+    if token.typ == itemFor {
+        // the variables declared by the loop belong to an implicit block
+        // around it
+        openScope(p)
+        structure, token := parseFor(token, p)
+        closeScope(p)
+
+        return structure, token
+    }
+
+    return nil, token
+}
+
+// parseBranch reads a break, continue, goto or fallthrough statement. goto
+// needs a label, break and continue may have one.
+func parseBranch(token *item, p *parser) (*BranchStmt, *item) {
+    branch := &BranchStmt{span: span{pos: token.pos, end: token.end}, Tok: token.typ}
+
+    token = getNextToken(p)
+
+    if branch.Tok == itemGoto && token.typ != itemIdentifier {
+        parseError(p, token, itemIdentifier)
+    }
+
+    if token.typ == itemIdentifier && branch.Tok != itemFallthrough {
+        branch.Label = newIdent(token)
+        branch.end = token.end
+        token = getNextToken(p)
+    }
+
+    return branch, token
+}
+
+// parseLabeledStatement reads the statement that follows "label:". x is the
+// expression statement read in front of the colon.
+func parseLabeledStatement(x Stmt, token *item, p *parser) (*LabeledStmt, *item) {
+    var label *Ident
+
+    if expression, ok := x.(*ExprStmt); ok {
+        label, _ = expression.X.(*Ident)
+    }
+
+    if label == nil {
+        parseError(p, token, itemSemiColon)
+    }
+
+    labeled := &LabeledStmt{span: span{pos: label.pos}, Label: label}
+
+    token = getNextToken(p)
+
+    // a label may end a block, it then labels an empty statement
+    if token.typ == itemRightDelim || token.typ == itemSemiColon {
+        labeled.Stmt = &EmptyStmt{span{pos: token.pos, end: token.pos}}
+    } else {
+        labeled.Stmt, token = parseInstruction(token, p)
+
+        if labeled.Stmt == nil {
+            parseError(p, token, itemSemiColon)
+        }
+    }
+
+    labeled.end = labeled.Stmt.End()
+
+    return labeled, token
+}
+
+// checkBody reports the statements of a function body that are only valid
+// in some places: fallthrough as the last statement of a switch clause that
+// is not the last one, and x.(type) as the guard of a type switch.
+func checkBody(body *BlockStmt, p *parser) {
+    checkBranches(body, p)
+
+    allowed := map[Node]bool{}
+
+    Inspect(body, func(node Node) bool {
+        switch n := node.(type) {
+        case *FuncLit:
+            // checked on its own
+            return false
+        case *SwitchStmt:
+            clauses := n.Body.List
+
+            for i, clause := range clauses {
+                if last := lastFallthrough(clause); last != nil {
+                    allowed[last] = true
+
+                    if i == len(clauses) - 1 {
+                        reportError(p, last.pos, "cannot fallthrough final case in switch")
+                    }
+                }
+            }
+        case *TypeSwitchStmt:
+            switch guard := n.Assign.(type) {
+            case *ExprStmt:
+                allowed[guard.X] = true
+            case *AssignStmt:
+                allowed[guard.Rhs[0]] = true
+            }
+
+            for _, clause := range n.Body.List {
+                if last := lastFallthrough(clause); last != nil {
+                    allowed[last] = true
+                    reportError(p, last.pos, "cannot fallthrough in type switch")
+                }
+            }
+        case *BranchStmt:
+            if n.Tok == itemFallthrough && !allowed[n] {
+                reportError(p, n.pos, "fallthrough statement out of place")
+            }
+        case *TypeAssertExpr:
+            if n.Type == nil && !allowed[n] {
+                reportError(p, n.pos, "use of .(type) outside type switch")
+            }
+        }
+
+        return true
+    })
+}
+
+// checkImplementations checks the package level var declarations of an
+// interface type of the file, like var _ I = (*T)(nil), whose values are
+// of a type of the file: the type must implement the interface. It runs
+// once the whole file is read, as methods may be declared anywhere.
+func checkImplementations(file *File, p *parser) {
+    var decls []Decl
+
+    for _, decl := range file.Decls {
+        if group, ok := decl.(*DeclGroup); ok {
+            decls = append(decls, group.Decls...)
+        } else {
+            decls = append(decls, decl)
+        }
+    }
+
+    for _, decl := range decls {
+        variable, ok := decl.(*VarDecl)
+
+        if !ok {
+            continue
+        }
+
+        name, ok := variable.Type.(*Ident)
+
+        if !ok || file.typeDecl(name.Name) == nil {
+            continue
+        }
+
+        iface, ok := file.typeDecl(name.Name).Type.(*InterfaceType)
+
+        if !ok {
+            continue
+        }
+
+        if file.isConstraint(iface) {
+            reportError(p, name.pos, fmt.Sprintf("cannot use type %s outside a type constraint: interface contains type constraints", name.Name))
+
+            continue
+        }
+
+        for _, value := range variable.Values {
+            typ, pointer, known := staticType(value, file)
+
+            if !known {
+                continue
+            }
+
+            if implements, reason := file.Implements(typ, pointer, iface); !implements {
+                if pointer {
+                    typ = "*" + typ
+                }
+
+                reportError(p, value.Pos(), fmt.Sprintf("cannot use %s (value of type %s) as %s value in variable declaration: %s does not implement %s (%s)", p.lex.input[value.Pos():value.End()], typ, name.Name, typ, name.Name, reason))
+            }
+        }
+    }
+}
+
+// staticType returns the type of the file that x evidently has, T or *T:
+// for T{}, &T{}, T(x), (*T)(x) and new(T).
+func staticType(x Expr, file *File) (string, bool, bool) {
+    pointer := false
+
+    if address, ok := x.(*UnaryExpr); ok && address.Op == itemAmpersand {
+        if _, ok := address.X.(*CompositeLit); ok {
+            x, pointer = address.X, true
+        }
+    }
+
+    var typ Expr
+
+    switch x := x.(type) {
+    case *CompositeLit:
+        typ = x.Type
+    case *CallExpr:
+        if len(x.Args) != 1 {
+            return "", false, false
+        }
+
+        typ = x.Fun
+
+        if name, ok := x.Fun.(*Ident); ok && name.Name == "new" && file.typeDecl("new") == nil {
+            typ, pointer = x.Args[0], true
+        } else if star, ok := x.Fun.(*StarExpr); ok {
+            typ, pointer = star.X, true
+        }
+    }
+
+    name, ok := typ.(*Ident)
+
+    if !ok || file.typeDecl(name.Name) == nil {
+        return "", false, false
+    }
+
+    return name.Name, pointer, true
+}
+
+// hasBadStatement reports whether a statement of body, or of the blocks
+// and function literals it holds, was dropped for a syntax error.
+func hasBadStatement(body *BlockStmt) bool {
+    found := false
+
+    Inspect(body, func(node Node) bool {
+        if _, ok := node.(*BadStmt); ok {
+            found = true
+        }
+
+        return !found
+    })
+
+    return found
+}
+
+// checkBranches reports labels that are defined twice or never used, and
+// the break, continue and goto statements without a valid target. A body
+// with a syntax error is not checked, the statement it dropped may hold a
+// label or its use.
+func checkBranches(body *BlockStmt, p *parser) {
+    if hasBadStatement(body) {
+        return
+    }
+
+    labels := map[string]*LabeledStmt{}
+    used := map[string]bool{}
+
+    // labels are visible in the whole function body, also before the
+    // label, but not in the function literals it holds
+    Inspect(body, func(node Node) bool {
+        if _, ok := node.(*FuncLit); ok {
+            return false
+        }
+
+        if labeled, ok := node.(*LabeledStmt); ok {
+            name := labeled.Label.Name
+
+            if labels[name] != nil {
+                reportError(p, labeled.Label.pos, fmt.Sprintf("label %s already defined at %s", name, p.lex.file.Position(labels[name].Label.pos)))
+            } else {
+                labels[name] = labeled
+            }
+        }
+
+        return true
+    })
+
+    var enclosing []Node
+    var walk func(node Node)
+
+    walk = func(node Node) {
+        if _, ok := node.(*FuncLit); ok {
+            return
+        }
+
+        if branch, ok := node.(*BranchStmt); ok {
+            if branch.Label != nil {
+                used[branch.Label.Name] = true
+            }
+
+            checkBranch(branch, enclosing, labels, p)
+        }
+
+        enclosing = append(enclosing, node)
+
+        for _, child := range children(node) {
+            walk(child)
+        }
+
+        enclosing = enclosing[:len(enclosing) - 1]
+    }
+
+    walk(body)
+
+    for name, labeled := range labels {
+        if !used[name] {
+            reportError(p, labeled.Label.pos, fmt.Sprintf("label %s defined and not used", name))
+        }
+    }
+}
+
+// checkBranch checks the target of branch, given the nodes that enclose it
+// from the outermost to the innermost.
+func checkBranch(branch *BranchStmt, enclosing []Node, labels map[string]*LabeledStmt, p *parser) {
+    if branch.Tok == itemFallthrough {
+        return
+    }
+
+    if branch.Label != nil {
+        name := branch.Label.Name
+        labeled := labels[name]
+
+        if labeled == nil {
+            reportError(p, branch.Label.pos, fmt.Sprintf("label %s not defined", name))
+
+            return
+        }
+
+        if branch.Tok == itemGoto {
+            return
+        }
+
+        for _, node := range enclosing {
+            if node == Node(labeled) && isBranchTarget(labeled.Stmt, branch.Tok) {
+                return
+            }
+        }
+
+        reportError(p, branch.Label.pos, fmt.Sprintf("invalid %s label %s", branchKeyword(branch.Tok), name))
+
+        return
+    }
+
+    for i := len(enclosing) - 1; i >= 0; i-- {
+        if isBranchTarget(enclosing[i], branch.Tok) {
+            return
+        }
+    }
+
+    if branch.Tok == itemBreak {
+        reportError(p, branch.pos, "break is not in a loop, switch, or select")
+    } else {
+        reportError(p, branch.pos, "continue is not in a loop")
+    }
+}
+
+func branchKeyword(tok itemType) string {
+    if tok == itemBreak {
+        return "break"
+    }
+
+    return "continue"
+}
+
+// isBranchTarget reports whether a break or a continue, as given by tok, can
+// leave or repeat the statement.
+func isBranchTarget(statement Node, tok itemType) bool {
+    switch statement.(type) {
+    case *ForStmt, *RangeStmt:
+        return true
+    case *SwitchStmt, *TypeSwitchStmt:
+        return tok == itemBreak
+    }
+
+    return false
+}
+
+// lastFallthrough returns the fallthrough statement that ends clause, or
+// nil.
+func lastFallthrough(clause Stmt) *BranchStmt {
+    body := clause.(*CaseClause).Body
+
+    if len(body) == 0 {
+        return nil
+    }
+
+    if last, ok := body[len(body) - 1].(*BranchStmt); ok && last.Tok == itemFallthrough {
+        return last
+    }
+
+    return nil
+}
+
+// parseIf reads an if statement with its optional init statement and else
+// branch. An else-if chain is a nest of if statements, each in the Else of
+// the previous one.
+func parseIf(token *item, p *parser) (*IfStmt, *item) {
+    // the variables declared by the init statement belong to an implicit
+    // block around the statement, else branches included
+    openScope(p)
+    defer closeScope(p)
+
+    structure := &IfStmt{span: span{pos: token.pos}}
+
+    p.exprLevel = -1
+    token = getNextToken(p)
+
+    if token.typ == itemLeftDelim {
+        reportError(p, token.pos, "missing condition in if statement")
+        structure.Cond = &BadExpr{span{pos: token.pos, end: token.pos}}
+    } else {
+        var init Stmt
+
+        if token.typ != itemSemiColon {
+            init, token = parseSimpleStatement(token, false, p)
+        }
+
+        if token.typ == itemSemiColon {
+            if token.val == "\n" {
+                syntaxError(p, token, "unexpected newline, expecting { after if clause")
+            }
+
+            structure.Init = init
+            structure.Cond, token = parseExpression(getNextToken(p), p)
+        } else if condition, ok := init.(*ExprStmt); ok {
+            structure.Cond = condition.X
+        } else {
+            syntaxError(p, token, fmt.Sprintf("cannot use %s as value", p.lex.input[init.Pos():init.End()]))
+        }
+    }
+
+    if token.typ != itemLeftDelim {
+        syntaxError(p, token, fmt.Sprintf("unexpected %s, expecting { after if clause", describeToken(token)))
+    }
+
+    structure.Body, token = parseBody(token, p)
+    structure.end = structure.Body.end
+
+    if token.typ != itemElse {
+        return structure, token
+    }
+
+    token = getNextToken(p)
+
+    switch token.typ {
+    case itemIf:
+        var elseIf *IfStmt
+
+        elseIf, token = parseIf(token, p)
+        structure.Else = elseIf
+    case itemLeftDelim:
+        var elseBody *BlockStmt
+
+        elseBody, token = parseBody(token, p)
+        structure.Else = elseBody
+    default:
+        syntaxError(p, token, "else must be followed by if or statement block")
+    }
+
+    structure.end = structure.Else.End()
+
+    return structure, token
+}
+
+// parseSwitch reads an expression switch or a type switch, with its
+// optional init statement.
+func parseSwitch(token *item, p *parser) (Stmt, *item) {
+    openScope(p)
+    defer closeScope(p)
+
+    start := token.pos
+    p.exprLevel = -1
+    token = getNextToken(p)
+
+    var init, header Stmt
+
+    if token.typ != itemLeftDelim {
+        if token.typ != itemSemiColon {
+            header, token = parseSimpleStatement(token, false, p)
+        }
+
+        if token.typ == itemSemiColon {
+            init, header = header, nil
+            token = getNextToken(p)
+
+            if token.typ != itemLeftDelim {
+                header, token = parseSimpleStatement(token, false, p)
+            }
+        }
+    }
+
+    if token.typ != itemLeftDelim {
+        syntaxError(p, token, fmt.Sprintf("unexpected %s, expecting { after switch clause", describeToken(token)))
+    }
+
+    body := &BlockStmt{span: span{pos: token.pos}}
+    isTypeSwitch := isTypeSwitchGuard(header)
+
+    // the case expressions are not part of the header, T{ is a literal there
+    p.exprLevel = 0
+    token = parseCaseClauses(body, getNextToken(p), isTypeSwitch, p)
+
+    if token.typ != itemRightDelim {
+        parseError(p, token, itemRightDelim)
+    }
+
+    body.end = token.end
+
+    if isTypeSwitch {
+        return &TypeSwitchStmt{span: span{pos: start, end: body.end}, Init: init, Assign: header, Body: body}, getNextToken(p)
+    }
+
+    structure := &SwitchStmt{span: span{pos: start, end: body.end}, Init: init, Body: body}
+
+    if header != nil {
+        tag, ok := header.(*ExprStmt)
+
+        if !ok {
+            reportError(p, header.Pos(), fmt.Sprintf("cannot use %s as value", p.lex.input[header.Pos():header.End()]))
+        } else {
+            structure.Tag = tag.X
+        }
+    }
+
+    return structure, getNextToken(p)
+}
+
+// isTypeSwitchGuard reports whether header is x.(type) or v := x.(type).
+func isTypeSwitchGuard(header Stmt) bool {
+    var x Expr
+
+    switch header := header.(type) {
+    case *ExprStmt:
+        x = header.X
+    case *AssignStmt:
+        if header.Tok != itemDeclare || len(header.Lhs) != 1 || len(header.Rhs) != 1 {
+            return false
+        }
+
+        x = header.Rhs[0]
+    default:
+        return false
+    }
+
+    assertion, ok := x.(*TypeAssertExpr)
+
+    return ok && assertion.Type == nil
+}
+
+// parseCaseClauses reads the clauses of a switch up to its closing "}".
+func parseCaseClauses(body *BlockStmt, token *item, isTypeSwitch bool, p *parser) *item {
+    hasDefault := false
+
+    for token.typ == itemCase || token.typ == itemDefault {
+        clause := &CaseClause{span: span{pos: token.pos}}
+
+        if token.typ == itemDefault {
+            if hasDefault {
+                reportError(p, token.pos, "multiple defaults in switch")
+            }
+
+            hasDefault = true
+            token = getNextToken(p)
+        } else if isTypeSwitch {
+            clause.List, token = parseTypeList(nil, getNextToken(p), p)
+        } else {
+            clause.List, token = parseExpressions(nil, getNextToken(p), p)
+        }
+
+        if token.typ != itemColon {
+            parseError(p, token, itemColon)
+        }
+
+        clause.end = token.end
+
+        // every clause is a block of its own
+        openScope(p)
+        statements := &BlockStmt{}
+        token = parseInstructionList(statements, getNextToken(p), p)
+        closeScope(p)
+
+        clause.Body = statements.List
+
+        if len(clause.Body) > 0 {
+            clause.end = clause.Body[len(clause.Body) - 1].End()
+        }
+
+        body.List = append(body.List, clause)
+    }
+
+    return token
+}
+
+// parseTypeList reads the types of a type switch case. nil, which stands
+// for the nil interface value, is read as a type name.
+func parseTypeList(list []Expr, token *item, p *parser) ([]Expr, *item) {
+    typ, token := parseType(token, p)
+    list = append(list, typ)
+
+    if token.typ == itemComma {
+        return parseTypeList(list, getNextToken(p), p)
+    }
+
+    return list, token
+}
+
+// parseFor reads the forms of the for statement: a loop with a single
+// condition or none, a loop with init, condition and post statements, and a
+// loop over a range.
+func parseFor(token *item, p *parser) (Stmt, *item) {
+    start := token.pos
+    p.exprLevel = -1
+    token = getNextToken(p)
+
+    if token.typ == itemRange {
+        loop := &RangeStmt{span: span{pos: start}}
+
+        loop.X, token = parseExpression(getNextToken(p), p)
+        loop.Body, token = parseBody(token, p)
+        loop.end = loop.Body.end
+
+        return loop, token
+    }
+
+    structure := &ForStmt{span: span{pos: start}}
+
+    if token.typ != itemLeftDelim {
+        var init Stmt
+
+        if token.typ != itemSemiColon {
+            init, token = parseSimpleStatement(token, true, p)
+        }
+
+        if loop, ok := init.(*RangeStmt); ok {
+            loop.pos = start
+            loop.Body, token = parseBody(token, p)
+            loop.end = loop.Body.end
+
+            return loop, token
+        }
+
+        if token.typ == itemSemiColon {
+            structure.Init = init
+            token = getNextToken(p)
+
+            if token.typ != itemSemiColon {
+                structure.Cond, token = parseExpression(token, p)
+            }
+
+            if token.typ != itemSemiColon {
+                parseError(p, token, itemSemiColon)
+            }
+
+            token = getNextToken(p)
+
+            if token.typ != itemLeftDelim {
+                structure.Post, token = parseSimpleStatement(token, false, p)
+
+                if assignment, ok := structure.Post.(*AssignStmt); ok && assignment.Tok == itemDeclare {
+                    reportError(p, assignment.pos, "cannot declare in post statement of for loop")
+                }
+            }
+        } else {
+            condition, ok := init.(*ExprStmt)
+
+            if !ok {
+                parseError(p, token, itemSemiColon)
+            }
+
+            structure.Cond = condition.X
+        }
+    }
+
+    structure.Body, token = parseBody(token, p)
+    structure.end = structure.Body.end
+
+    return structure, token
+}
+
+// parseSimpleStatement reads a statement that can stand in the header of a
+// for statement. A range clause is accepted when rangeClause is set, and
+// returned as a RangeStmt without body.
+func parseSimpleStatement(token *item, rangeClause bool, p *parser) (Stmt, *item) {
+    if !startsExpression(token) {
+        parseError(p, token, itemLeftDelim)
+    }
+
+    return parseInstructionExpression(token, rangeClause, p)
+}
+
+// parseExpression reads a whole expression. Binary operators are combined
+// by precedence climbing, so that the tree follows Go's five precedence
+// levels and operators of the same level associate to the left.
+func parseExpression(token *item, p *parser) (Expr, *item) {
+    return parseBinaryExpression(1, token, p)
+}
+
+// parseBinaryExpression reads an expression whose operators all have a
+// precedence of at least minimum.
+func parseBinaryExpression(minimum int, token *item, p *parser) (Expr, *item) {
+    x, token := parseUnaryExpression(token, p)
+
+    return parseBinaryOperators(minimum, x, token, p)
+}
+
+// parseBinaryOperators reads the operators of precedence at least minimum
+// that follow the operand x, with their right operands.
+func parseBinaryOperators(minimum int, x Expr, token *item, p *parser) (Expr, *item) {
+    for precedence(token.typ) >= minimum {
+        op := token.typ
+
+        var y Expr
+        y, token = parseBinaryExpression(precedence(op) + 1, getNextToken(p), p)
+        x = newBinary(x, op, y)
+    }
+
+    return x, token
+}
+
+func newBinary(x Expr, op itemType, y Expr) *BinaryExpr {
+    return &BinaryExpr{span: span{pos: x.Pos(), end: y.End()}, X: x, Op: op, Y: y}
+}
+
+// precedence returns the precedence of a binary operator, from 5 for the
+// multiplicative ones down to 1 for ||, or 0 if typ is not a binary operator.
+func precedence(typ itemType) int {
+    switch typ {
+    case itemMupltiply, itemDivide, itemRest, itemShiftLeft, itemShiftRight, itemAmpersand, itemAndNot:
+        return 5
+    case itemPlus, itemMinus, itemPipe, itemXor:
+        return 4
+    case itemEqual, itemNotEqual, itemLower, itemLowerOrEqual, itemGreater, itemGreaterOrEqual:
+        return 3
+    case itemAnd:
+        return 2
+    case itemOr:
+        return 1
+    }
+
+    return 0
+}
+
+// startsExpression reports whether token can begin an expression.
+func startsExpression(token *item) bool {
+    switch token.typ {
+    case itemIdentifier, itemNumber, itemString, itemRawString, itemCharConstant, itemLeftParen,
+        itemLeftBrack, itemStruct, itemMap, itemInterface, itemFunctionDefine, itemPlus, itemMinus, itemNot, itemXor, itemMupltiply, itemAmpersand:
+        return true
+    }
+
+    return false
+}
+
+// parseUnaryExpression reads an operand preceded by any number of unary
+// operators. They bind tighter than every binary operator.
+func parseUnaryExpression(token *item, p *parser) (Expr, *item) {
+    switch token.typ {
+    case itemPlus, itemMinus, itemNot, itemXor, itemAmpersand:
+        unary := &UnaryExpr{span: span{pos: token.pos}, Op: token.typ}
+
+        unary.X, token = parseUnaryExpression(getNextToken(p), p)
+        unary.end = unary.X.End()
+
+        return unary, token
+    case itemMupltiply:
+        // a dereference, or a pointer type in a conversion or an argument
+        // of new
+        pointer := &StarExpr{span: span{pos: token.pos}}
+
+        pointer.X, token = parseUnaryExpression(getNextToken(p), p)
+        pointer.end = pointer.X.End()
+
+        return pointer, token
+    }
+
+    return parseOperand(token, p)
+}
+
+// parseOperand reads an identifier, a literal or a parenthesized expression
+// together with the index expressions, calls and selectors that follow it.
+// The parentheses leave no node in the tree, its shape already records the
+// grouping.
+func parseOperand(token *item, p *parser) (Expr, *item) {
+    if token.typ == itemIdentifier {
+        x := newIdent(token)
+        resolve(x, p)
+
+        return parseExtendedFactor(x, getNextToken(p), p)
+    }
+
+    if token.typ == itemNumber || token.typ == itemString || token.typ == itemRawString || token.typ == itemCharConstant {
+        return newBasicLit(token), getNextToken(p)
+    }
+
+    if token.typ == itemLeftParen {
+        p.exprLevel++
+        x, token := parseExpression(getNextToken(p), p)
+        p.exprLevel--
+
+        if token.typ != itemRightParen {
+            parseError(p, token, itemRightParen)
+        }
+
+        return parseExtendedFactor(x, getNextToken(p), p)
+    }
+
+    if token.typ == itemLeftBrack {
+        // the type of a composite literal or of a conversion
+        array, token := parseArrayType(token, p)
+
+        if _, ok := array.Len.(*Ellipsis); ok && token.typ != itemLeftDelim {
+            reportError(p, array.pos, "invalid use of [...] array (outside a composite literal)")
+        }
+
+        return parseExtendedFactor(array, token, p)
+    }
+
+    if token.typ == itemStruct || token.typ == itemMap || token.typ == itemInterface {
+        typ, token := parseType(token, p)
+
+        return parseExtendedFactor(typ, token, p)
+    }
+
+    if token.typ == itemFunctionDefine {
+        typ, token := parseFuncType(token, p)
+
+        // without a body it is the type of a conversion
+        if token.typ != itemLeftDelim {
+            return parseExtendedFactor(typ, token, p)
+        }
+
+        literal, token := parseFuncLit(typ, token, p)
+
+        return parseExtendedFactor(literal, token, p)
+    }
+
+    parseError(p, token, itemNumber)
+
+    return nil, token
+}
+
+// parseDeclaration reads a const, type or var declaration from its keyword
+// in token: a single one, or a group of them in parentheses.
+func parseDeclaration(token *item, p *parser) (declStmt, *item) {
+    keyword := token
+    token = getNextToken(p)
+
+    if token.typ != itemLeftParen {
+        return parseSpec(keyword.typ, keyword.pos, token, 0, nil, p)
+    }
+
+    group := &DeclGroup{span: span{pos: keyword.pos}, Tok: keyword.typ}
+    var previous *ConstDecl
+
+    token = getNextToken(p)
+
+    for token.typ != itemRightParen && token.typ != itemEOF {
+        var spec declStmt
+
+        spec, token = parseSpec(keyword.typ, token.pos, token, len(group.Decls), previous, p)
+
+        if constant, ok := spec.(*ConstDecl); ok && len(constant.Values) > 0 {
+            previous = constant
+        }
+
+        group.Decls = append(group.Decls, spec)
+        token = parseSemiColon(token, p)
+    }
+
+    if token.typ != itemRightParen {
+        parseError(p, token, itemRightParen)
+    }
+
+    group.end = token.end
+
+    return group, getNextToken(p)
+}
+
+// parseSpec reads one declaration of the kind of keyword, starting at start,
+// from its first name in token. iota and previous are the index of a const
+// declaration in its group and the last one before it with values.
+func parseSpec(keyword itemType, start Pos, token *item, iota int, previous *ConstDecl, p *parser) (declStmt, *item) {
+    switch keyword {
+    case itemConst:
+        return parseConstSpec(start, token, iota, previous, p)
+    case itemVar:
+        return parseVarSpec(start, token, p)
+    }
+
+    return parseTypeSpec(start, token, p)
+}
+
+// parseNames reads a comma separated list of identifiers.
+func parseNames(token *item, p *parser) ([]*Ident, *item) {
+    var names []*Ident
+
+    for {
+        if token.typ != itemIdentifier {
+            parseError(p, token, itemIdentifier)
+        }
+
+        names = append(names, newIdent(token))
+        token = getNextToken(p)
+
+        if token.typ != itemComma {
+            return names, token
+        }
+
+        token = getNextToken(p)
+    }
+}
+
+func parseVarSpec(start Pos, token *item, p *parser) (*VarDecl, *item) {
+    declaration := &VarDecl{span: span{pos: start}}
+
+    declaration.Names, token = parseNames(token, p)
+    declaration.end = declaration.Names[len(declaration.Names) - 1].end
+
+    if token.typ != itemAssign {
+        declaration.Type, token = parseType(token, p)
+        declaration.end = declaration.Type.End()
+    }
+
+    if token.typ == itemAssign {
+        declaration.Values, token = parseExpressions(nil, getNextToken(p), p)
+        declaration.end = declaration.Values[len(declaration.Values) - 1].End()
+
+        checkValueCount(declaration.Names[0].pos, len(declaration.Names), declaration.Values, p)
+    }
+
+    // the names are only visible after the declaration
+    for _, name := range declaration.Names {
+        p.scope.declare(name)
+    }
+
+    return declaration, token
+}
+
+// parseConstSpec reads a const declaration and evaluates its values. Inside
+// a group, a declaration without values repeats the type and the values of
+// previous, with its own iota.
+func parseConstSpec(start Pos, token *item, iota int, previous *ConstDecl, p *parser) (*ConstDecl, *item) {
+    declaration := &ConstDecl{span: span{pos: start}, Iota: iota}
+
+    declaration.Names, token = parseNames(token, p)
+    declaration.end = declaration.Names[len(declaration.Names) - 1].end
+
+    if token.typ != itemAssign && token.typ != itemSemiColon && token.typ != itemRightParen {
+        declaration.Type, token = parseType(token, p)
+        declaration.end = declaration.Type.End()
+    }
+
+    if token.typ == itemAssign {
+        declaration.Values, token = parseExpressions(nil, getNextToken(p), p)
+        declaration.end = declaration.Values[len(declaration.Values) - 1].End()
+    }
+
+    typ, values := declaration.Type, declaration.Values
+    repeated := len(values) == 0 && typ == nil && previous != nil
+
+    if repeated {
+        typ, values = previous.Type, previous.Values
+    }
+
+    names := declaration.Names
+
+    switch {
+    case len(values) == 0:
+        reportError(p, names[0].pos, "missing init expr for const declaration")
+    case len(names) > len(values):
+        reportError(p, names[len(values)].pos, "missing init expr for const declaration")
+    case len(names) < len(values) && !repeated:
+        reportError(p, values[len(names)].Pos(), "extra init expr")
+    case len(names) < len(values):
+        reportError(p, names[0].pos, "extra init expr")
+    }
+
+    declaration.Constants = make([]*Constant, len(names))
+
+    for i := range names {
+        if i < len(values) {
+            declaration.Constants[i] = evalConstantDeclaration(typ, values[i], repeated, names[i], iota, p)
+        }
+    }
+
+    // the names are only visible after the declaration
+    for i, name := range names {
+        p.scope.declare(name)
+        p.constants[name] = declaration.Constants[i]
+    }
+
+    return declaration, token
+}
+
+// evalConstantDeclaration evaluates the value x of the constant name, of
+// type typ when it is not nil. Errors in the values repeated from a previous
+// declaration are reported at name.
+func evalConstantDeclaration(typ Expr, x Expr, repeated bool, name *Ident, iota int, p *parser) *Constant {
+    value, pos, err := evalConstant(x, iota, p)
+
+    if err == nil && value != nil && typ != nil {
+        var basic *basicType
+
+        basic, err = constantType(typ, p)
+        pos = typ.Pos()
+
+        if err == nil {
+            value, err = convertConstant(value, p.lex.input[typ.Pos():typ.End()], basic, false)
+            pos = x.Pos()
+        }
+    }
+
+    if err != nil {
+        if repeated {
+            pos = name.pos
+        }
+
+        reportError(p, pos, err.Error())
+
+        return nil
+    }
+
+    return value
+}
+
+// constantType returns the predeclared type the type of a constant is based
+// on, following declared types, or nil when it is not known in this file.
+// Only booleans, numbers and strings can be constants.
+func constantType(typ Expr, p *parser) (*basicType, error) {
+    start := typ
+
+    for range [16]struct{}{} {
+        name, ok := typ.(*Ident)
+
+        if !ok {
+            break
+        }
+
+        declaration := p.scope.lookup(name.Name)
+
+        if basic, ok := basicTypes[name.Name]; ok && declaration == nil {
+            return &basic, nil
+        }
+
+        if underlying, ok := p.types[declaration]; ok {
+            typ = underlying
+
+            continue
+        }
+
+        if declaration == nil {
+            return nil, nil
+        }
+
+        return nil, fmt.Errorf("%s is not a type", name.Name)
+    }
+
+    if _, ok := typ.(*SelectorExpr); ok {
+        return nil, nil
+    }
+
+    return nil, fmt.Errorf("invalid constant type %s", p.lex.input[start.Pos():start.End()])
+}
+
+// evalConstant evaluates the constant expression x, in which iota has the
+// given value. The constant is nil without an error when x depends on names
+// that are not known, such as the constants of other packages. An error
+// comes with the position of the part of x it is about.
+func evalConstant(x Expr, iota int, p *parser) (*Constant, Pos, error) {
+    notConstant := fmt.Errorf("%s is not constant", p.lex.input[x.Pos():x.End()])
+
+    switch x := x.(type) {
+    case *BasicLit:
+        return literalConstant(x), x.pos, nil
+    case *Ident:
+        declaration := p.scope.lookup(x.Name)
+
+        if declaration == nil {
+            switch {
+            case predeclared[x.Name] == predeclaredConstant && x.Name == "iota":
+                return &Constant{Kind: constantInt, Value: big.NewInt(int64(iota))}, x.pos, nil
+            case predeclared[x.Name] == predeclaredConstant:
+                return boolConstant(x.Name == "true"), x.pos, nil
+            case predeclared[x.Name] != 0:
+                return nil, x.pos, notConstant
+            }
+
+            return nil, x.pos, nil
+        }
+
+        if value, ok := p.constants[declaration]; ok {
+            return value, x.pos, nil
+        }
+
+        return nil, x.pos, notConstant
+    case *UnaryExpr:
+        operand, pos, err := evalConstant(x.X, iota, p)
+
+        if operand == nil || err != nil {
+            return nil, pos, err
+        }
+
+        value, err := unaryConstant(x.Op, operand)
+
+        return value, x.pos, err
+    case *BinaryExpr:
+        left, pos, err := evalConstant(x.X, iota, p)
+
+        if left == nil || err != nil {
+            return nil, pos, err
+        }
+
+        right, pos, err := evalConstant(x.Y, iota, p)
+
+        if right == nil || err != nil {
+            return nil, pos, err
+        }
 
-        token = getNextToken(lex, false)
+        value, err := binaryConstant(x.Op, left, right)
 
-        if token.typ == itemFunctionName {
-            token = parseFunction(tree, functionNode, token, lex, currentLevel + 2)
-            token = getNextToken(lex, true)
-        } else {
-            parseErrorPrint(token, itemFunctionName)
+        return value, x.pos, err
+    case *CallExpr:
+        return evalConstantCall(x, iota, p)
+    case *SelectorExpr:
+        // a constant of another package
+        if _, ok := x.X.(*Ident); ok {
+            return nil, x.pos, nil
         }
-    } else {
-        parseErrorPrint(token, itemFunctionDefine)
     }
 
-    return parseFunctionsList(tree, node, token, lex, currentLevel)
+    return nil, x.Pos(), notConstant
 }
 
-func parseParameters(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    token = parseParameter(tree, node, token, lex, currentLevel)
+// evalConstantCall evaluates the conversion of a constant, as in T(x), and
+// len of a constant string. Other calls are not constant, except for the
+// ones to builtins or to names this file does not know.
+func evalConstantCall(call *CallExpr, iota int, p *parser) (*Constant, Pos, error) {
+    name, ok := call.Fun.(*Ident)
 
-    if token.val == "," && token.typ == itemChar {
-        token = getNextToken(lex, false)
-        token = parseParameters(tree, node, token, lex, currentLevel)
+    if !ok {
+        return nil, call.pos, nil
     }
 
-    return token
-}
+    declaration := p.scope.lookup(name.Name)
+    _, isType := p.types[declaration]
 
-func parseParameter(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ != itemIdentifier {
-        parseErrorPrint(token, itemIdentifier)
-    }
+    if declaration == nil && predeclared[name.Name] == predeclaredType || isType {
+        if len(call.Args) != 1 {
+            return nil, call.pos, fmt.Errorf("wrong argument count in conversion to %s", name.Name)
+        }
 
-    identifierNode := node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemIdentifier,
-            level: currentLevel,
-            text: "Identifier",
-            data: token.val,
-    })
+        value, pos, err := evalConstant(call.Args[0], iota, p)
 
-    token = getNextToken(lex, false)
+        if value == nil || err != nil {
+            return nil, pos, err
+        }
 
-    if token.typ == itemIntType || token.typ == itemStringType || token.typ == itemBoolType || token.typ == itemByteType {
-        identifierNode.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemVariableType,
-            level: currentLevel + 2,
-            text: "Variable type",
-            data: token.val,
-        })
-    } else {
-        parseErrorPrint(token, itemVariableType)
-    }
+        basic, err := constantType(name, p)
 
-    return getNextToken(lex, false)
-}
+        if err != nil {
+            return nil, call.pos, err
+        }
 
-//main parse function
-func parseInstructionList(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ == itemRightDelim {
-        return token
+        value, err = convertConstant(value, name.Name, basic, true)
+
+        return value, call.pos, err
     }
 
-    instructionNode := node.addChild(&AstTree{
-        key: time.Now().String(),
-        typ: itemNode,
-        level: currentLevel,
-        text: "itemInstruction",
-    })
+    if isBuiltin(name, "len", p) && len(call.Args) == 1 {
+        // the length of an array is constant too, but the type of the
+        // argument is not known here: the value is left unknown
+        value, _, err := evalConstant(call.Args[0], iota, p)
 
-    token = parseInstruction(tree, instructionNode, token, lex, currentLevel + 2)
+        if value == nil || err != nil || value.Kind != constantString {
+            return nil, call.pos, nil
+        }
 
-    if token.typ == itemRightDelim {
-        return token
+        return &Constant{Kind: constantInt, Value: big.NewInt(int64(len(value.Value.(string))))}, call.pos, nil
     }
 
-    if token.typ != itemNewLine && token.typ != itemSemiColon {
-        parseErrorPrint(token, itemNewLine)
+    if declaration == nil {
+        return nil, call.pos, nil
     }
 
-    token = getNextToken(lex, true)
-
-    return parseInstructionList(tree, node, token, lex, currentLevel)
+    return nil, call.pos, fmt.Errorf("%s is not constant", p.lex.input[call.Pos():call.End()])
 }
 
-func parseInstruction(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.val == "return" && token.typ == itemReturn {
-        childNode := node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemReturn,
-            level: currentLevel,
-            text: "itemReturn",
-            data: token.val,
-        })
+// parseTypeSpec reads Name T, or the alias declaration Name = T, after the
+// type keyword.
+func parseTypeSpec(start Pos, token *item, p *parser) (*TypeDecl, *item) {
+    declaration := &TypeDecl{span: span{pos: start}}
+
+    if token.typ != itemIdentifier {
+        parseError(p, token, itemIdentifier)
+    }
 
-        token = getNextToken(lex, false)
+    declaration.Name = newIdent(token)
 
-        token = parseExpression(tree, childNode, token, lex, currentLevel + 2)
+    // the name is visible in its own type, which can refer to itself
+    p.scope.declare(declaration.Name)
 
-        return token
-    }
+    token = getNextToken(p)
 
-    if itemVar == token.typ {
-        return parseDeclaration(tree, node, token, lex, currentLevel)
+    if token.typ == itemAssign {
+        declaration.Alias = true
+        token = getNextToken(p)
     }
 
-    if itemIdentifier == token.typ {
-        return parseInstructionExpression(tree, node, token, lex, currentLevel)
+    declaration.Type, token = parseType(token, p)
+    declaration.end = declaration.Type.End()
+    p.types[declaration.Name] = declaration.Type
+
+    return declaration, token
+}
+
+// parseCompositeLiteral reads the braced elements of a composite literal of
+// type typ. typ is nil for the elements of an enclosing literal, which may
+// leave out their type, elided is then the type of those elements when it
+// is known.
+func parseCompositeLiteral(typ Expr, elided Expr, token *item, p *parser) (*CompositeLit, *item) {
+    literal := &CompositeLit{span: span{pos: token.pos}, Type: typ}
+
+    if typ != nil {
+        literal.pos = typ.Pos()
+    } else {
+        typ = elided
     }
 
-    if token.val == "if" && token.typ == itemIf {
-        structureNode := node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemNode,
-            level: currentLevel,
-            text: "If structure",
-        })
+    p.exprLevel++
+    token = getNextToken(p)
 
-        token = getNextToken(lex, false)
+    for token.typ != itemRightDelim {
+        var element Expr
 
-        conditionNode := structureNode.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemNode,
-            level: currentLevel + 2,
-            text: "Condition",
-        })
+        element, token = parseElement(typ, token, p)
+        literal.Elts = append(literal.Elts, element)
 
-        token = parseExpression(tree, conditionNode, token, lex, currentLevel + 4)
+        if token.typ != itemComma {
+            break
+        }
 
-        if token.typ == itemLeftDelim {
-            bodyNode := structureNode.addChild(&AstTree{
-                    key: time.Now().String(),
-                    typ: itemNode,
-                    level: currentLevel + 2,
-                    text: "Body of structure",
-            })
+        token = getNextToken(p)
+    }
 
-            token = getNextToken(lex, true)
+    p.exprLevel--
 
-            token = parseInstructionList(tree, bodyNode, token, lex, currentLevel + 4)
+    if token.typ != itemRightDelim {
+        parseError(p, token, itemRightDelim)
+    }
 
-            if token.typ != itemRightDelim {
-                parseErrorPrint(token, itemRightDelim)
-            }
+    literal.end = token.end
 
-            token = getNextToken(lex, false)
+    return literal, getNextToken(p)
+}
 
-            if token.typ == itemElse {
-                elseNode := structureNode.addChild(&AstTree{
-                        key: time.Now().String(),
-                        typ: itemNode,
-                        level: currentLevel + 2,
-                        text: "Else structure",
-                })
+// parseElement reads an element of a composite literal, with its key if
+// it has one.
+func parseElement(typ Expr, token *item, p *parser) (Expr, *item) {
+    var value Expr
 
-                token = getNextToken(lex, true)
-                token = getNextToken(lex, true)
+    key, element := elementTypes(typ, p)
+    first := element
 
-                token = parseInstructionList(tree, elseNode, token, lex, currentLevel + 4)
+    if isMapType(typ, p) {
+        first = key
+    }
 
-                if token.typ != itemRightDelim {
-                    parseErrorPrint(token, itemRightDelim)
-                }
+    if token.typ == itemIdentifier {
+        // a name before a colon is a field name, unless the literal is a
+        // map, where it is a variable used as a key
+        name := newIdent(token)
+        token = getNextToken(p)
 
-                token = getNextToken(lex, false)
-            }
-        } else {
-            parseErrorPrint(token, itemLeftDelim)
+        if token.typ != itemColon || isMapType(typ, p) {
+            resolve(name, p)
         }
 
-        return token
+        value, token = parseExtendedFactor(name, token, p)
+        value, token = parseBinaryOperators(1, value, token, p)
+    } else {
+        value, token = parseElementValue(first, token, p)
     }
 
-    if token.val == "for" && token.typ == itemFor {
-        structureNode := node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemNode,
-            level: currentLevel,
-            text: "For (while) structure",
-        })
+    if token.typ != itemColon {
+        return value, token
+    }
 
-        token = getNextToken(lex, false)
+    pair := &KeyValueExpr{span: span{pos: value.Pos()}, Key: value}
 
-        conditionNode := structureNode.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemNode,
-            level: currentLevel + 2,
-            text: "Condition",
-        })
+    pair.Value, token = parseElementValue(element, getNextToken(p), p)
+    pair.end = pair.Value.End()
 
-        token = parseExpression(tree, conditionNode, token, lex, currentLevel + 4)
+    return pair, token
+}
 
-        if token.typ == itemLeftDelim {
-            bodyNode := structureNode.addChild(&AstTree{
-                    key: time.Now().String(),
-                    typ: itemNode,
-                    level: currentLevel + 2,
-                    text: "Body of structure",
-            })
+// parseElementValue reads a key or an element of a composite literal, of
+// type typ when it is known.
+func parseElementValue(typ Expr, token *item, p *parser) (Expr, *item) {
+    if token.typ == itemLeftDelim {
+        return parseCompositeLiteral(nil, typ, token, p)
+    }
 
-            token = getNextToken(lex, true)
+    return parseExpression(token, p)
+}
 
-            token = parseInstructionList(tree, bodyNode, token, lex, currentLevel + 4)
+// isMapType reports whether typ is a map type, or the name of one declared
+// in the file.
+func isMapType(typ Expr, p *parser) bool {
+    _, ok := underlyingType(typ, p).(*MapType)
 
-            if token.typ != itemRightDelim {
-                parseErrorPrint(token, itemRightDelim)
-            }
+    return ok
+}
 
-            token = getNextToken(lex, false)
-        } else {
-            parseErrorPrint(token, itemLeftDelim)
+// underlyingType returns the type declared for the type name typ, or typ
+// itself when it is not the name of a type of the file.
+func underlyingType(typ Expr, p *parser) Expr {
+    if name, ok := typ.(*Ident); ok {
+        if declaration := p.scope.lookup(name.Name); declaration != nil {
+            return p.types[declaration]
         }
-
-        return token
     }
 
-    return token
+    return typ
 }
 
-func parseExpression(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    parentNode := node.addChild(&AstTree{
-        key: time.Now().String(),
-        typ: itemNode,
-        level: currentLevel,
-        text: "Expression",
-    })
+// elementTypes returns the types of the keys and of the elements of a
+// composite literal of type typ, as far as they are known. The literals of
+// a pointer type *T leave out &T.
+func elementTypes(typ Expr, p *parser) (Expr, Expr) {
+    elided := func(x Expr) Expr {
+        if pointer, ok := x.(*StarExpr); ok {
+            return pointer.X
+        }
 
-    token = parseLogicalExpression(tree, parentNode, token, lex, currentLevel + 2)
-    token = parseExtendedExpression(tree, parentNode, token, lex, currentLevel + 2)
+        return x
+    }
 
-    return token
+    switch typ := underlyingType(typ, p).(type) {
+    case *ArrayType:
+        return nil, elided(typ.Elt)
+    case *MapType:
+        return elided(typ.Key), elided(typ.Value)
+    }
+
+    return nil, nil
 }
 
-func parseExtendedExpression(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ == itemOr || token.typ == itemAnd {
-        token = parseLogicalOperator(tree, node, token, lex, currentLevel)
-        token = parseLogicalExpression(tree, node, token, lex, currentLevel)
-        token = parseExtendedExpression(tree, node, token, lex, currentLevel)
+// isLiteralType reports whether x can be the type of a composite literal.
+// Type names are not, in the header of a statement: there the "{" after
+// them opens the body.
+func isLiteralType(x Expr, p *parser) bool {
+    switch x := x.(type) {
+    case *Ident:
+        return p.exprLevel >= 0
+    case *SelectorExpr:
+        _, isName := x.X.(*Ident)
+
+        return isName && p.exprLevel >= 0
+    case *ArrayType, *StructType, *MapType:
+        return true
     }
 
-    return token
+    return false
 }
 
-func parseLogicalOperator(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ == itemOr || token.val == "||" {
-        node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemOr,
-            level: currentLevel,
-            text: "itemOr",
-            data: token.val,
-        })
+// parseInstructionExpression reads an assignment, a short variable
+// declaration, an increment or decrement, or an expression used as a
+// statement.
+func parseInstructionExpression(token *item, rangeClause bool, p *parser) (Stmt, *item) {
+    lhs, names, token := parseTargets(nil, nil, token, p)
 
-        token = getNextToken(lex, false)
+    if token.typ != itemDeclare {
+        for _, name := range names {
+            resolve(name, p)
+        }
     }
 
-    if token.typ == itemAnd || token.val == "&&" {
-        node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemAnd,
-            level: currentLevel,
-            text: "itemAnd",
-            data: token.val,
-        })
+    if rangeClause && (token.typ == itemAssign || token.typ == itemDeclare) {
+        operator := token
+        token = getNextToken(p)
+
+        if token.typ == itemRange {
+            return parseRangeClause(lhs, operator, token, p)
+        }
 
-        token = getNextToken(lex, false)
+        // not a range clause after all, read the assignment
+        assignment := &AssignStmt{span: span{pos: lhs[0].Pos()}, Lhs: lhs, Tok: operator.typ}
+
+        return parseAssignment(assignment, token, p)
     }
 
-    return token
-}
+    if token.typ == itemAssign || token.typ == itemDeclare || isAssignOperator(token.typ) {
+        assignment := &AssignStmt{span: span{pos: lhs[0].Pos()}, Lhs: lhs, Tok: token.typ}
 
-func parseLogicalExpression(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.val == "!" && token.typ == itemNot {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNot,
-                level: currentLevel,
-                text: "itemNot",
-                data: token.val,
-        })
+        return parseAssignment(assignment, getNextToken(p), p)
+    }
 
-        token = getNextToken(lex, false)
+    if len(lhs) > 1 {
+        parseError(p, token, itemAssign)
     }
 
-    token = parseSimpleExpression(tree, node, token, lex, currentLevel)
-    token = parseExtendedLogicalExpression(tree, node, token, lex, currentLevel)
+    if token.typ == itemDoublePlus || token.typ == itemDoubleMinus {
+        statement := &IncDecStmt{span: span{pos: lhs[0].Pos(), end: token.end}, X: lhs[0], Tok: token.typ}
 
-    return token
-}
+        checkTargets(lhs, false, p)
 
-func parseDeclaration(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    declarationNode := node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemNode,
-            level: currentLevel,
-            text: "Declaration",
-    })
+        return statement, getNextToken(p)
+    }
 
-    token = getNextToken(lex, false)
+    return &ExprStmt{span: span{pos: lhs[0].Pos(), end: lhs[0].End()}, X: lhs[0]}, token
+}
 
-    if token.typ != itemIdentifier {
-        parseErrorPrint(token, itemIdentifier)
+// parseAssignment reads the values of an assignment whose targets and
+// operator have been read.
+func parseAssignment(assignment *AssignStmt, token *item, p *parser) (Stmt, *item) {
+    assignment.Rhs, token = parseExpressions(nil, token, p)
+    assignment.end = assignment.Rhs[len(assignment.Rhs) - 1].End()
+
+    if assignment.Tok == itemDeclare {
+        checkAssignment(assignment, p)
+        declareShort(assignment, p)
+    } else if assignment.Tok == itemAssign {
+        checkAssignment(assignment, p)
+        checkTargets(assignment.Lhs, true, p)
+    } else {
+        checkOperatorAssignment(assignment, p)
     }
 
-    identifierNode := declarationNode.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemIdentifier,
-            level: currentLevel + 2,
-            text: "itemIdentifier",
-            data: token.val,
-    })
-
-    token = getNextToken(lex, false)
+    return assignment, token
+}
 
-    if token.typ == itemIntType || token.typ == itemStringType || token.typ == itemBoolType || token.typ == itemByteType {
-        declarationNode.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemVariableType,
-            level: currentLevel + 2,
-            text: "Variable type",
-            data: token.val,
-        })
+// parseRangeClause reads the range expression of "k, v := range x" or
+// "k, v = range x". token is the range keyword.
+func parseRangeClause(lhs []Expr, operator *item, token *item, p *parser) (*RangeStmt, *item) {
+    loop := &RangeStmt{span: span{pos: lhs[0].Pos()}, Key: lhs[0], Tok: operator.typ}
 
-        token = getNextToken(lex, false)
+    if len(lhs) > 1 {
+        loop.Value = lhs[1]
+    }
 
-        if token.typ == itemNewLine {
-            return token
-        }
+    if len(lhs) > 2 {
+        reportError(p, lhs[2].Pos(), "range clause permits at most two iteration variables")
+    }
 
-        if token.typ != itemAssign {
-            parseErrorPrint(token, itemAssign)
-        }
+    loop.X, token = parseExpression(getNextToken(p), p)
 
-        token = getNextToken(lex, false)
+    if loop.Tok == itemAssign {
+        checkTargets(lhs, true, p)
 
-        return parseExpression(tree, declarationNode, token, lex, currentLevel + 2)
+        return loop, token
     }
 
-    if token.typ == itemAssign {
-        token = getNextToken(lex, false)
+    // the iteration variables are declared after the range expression
+    for _, x := range lhs {
+        if name, ok := x.(*Ident); ok {
+            p.scope.declare(name)
+        } else {
+            reportError(p, x.Pos(), "non-name on left side of :=")
+        }
+    }
 
-        if token.val == "[" && token.typ == itemChar {
-            indexNode := identifierNode.addChild(&AstTree{
-                    key: time.Now().String(),
-                    typ: itemNode,
-                    level: currentLevel + 2,
-                    text: "itemArraySize",
-                    data: token.val,
-            })
+    return loop, token
+}
 
-            token = getNextToken(lex, false)
+// isAssignOperator reports whether typ is one of +=, -=, *= and the other
+// operators that combine a binary operation with an assignment.
+func isAssignOperator(typ itemType) bool {
+    switch typ {
+    case itemPlusAssign, itemMinusAssign, itemMultiplyAssign, itemDivideAssign, itemRestAssign,
+        itemAmpersandAssign, itemPipeAssign, itemXorAssign, itemShiftLeftAssign, itemShiftRightAssign, itemAndNotAssign:
+        return true
+    }
 
-            token = parseSimpleExpression(tree, indexNode, token, lex, currentLevel + 4)
+    return false
+}
 
-            if token.val != "]" || token.typ != itemChar {
-                parseErrorPrint(token, itemChar)
-            }
+// checkAssignment reports assignments with more or less values than
+// targets. A single call may produce all the values.
+func checkAssignment(assignment *AssignStmt, p *parser) {
+    checkValueCount(assignment.pos, len(assignment.Lhs), assignment.Rhs, p)
+}
 
-            token = getNextToken(lex, false)
+// checkValueCount checks that there is one value for each of count
+// variables, unless the value is a single call, which may return several,
+// or a type assertion or an index expression in the v, ok form.
+func checkValueCount(pos Pos, count int, values []Expr, p *parser) {
+    if count == len(values) {
+        return
+    }
 
-            if token.typ == itemIntType || token.typ == itemStringType || token.typ == itemBoolType || token.typ == itemByteType {
-                declarationNode.addChild(&AstTree{
-                    key: time.Now().String(),
-                    typ: itemVariableType,
-                    level: currentLevel + 2,
-                    text: "Variable type",
-                    data: token.val,
-                })
-            } else {
-                parseErrorPrint(token, itemVariableType)
+    if len(values) == 1 {
+        switch values[0].(type) {
+        case *CallExpr:
+            return
+        case *TypeAssertExpr, *IndexExpr:
+            if count == 2 {
+                return
             }
+        }
+    }
 
-            token = getNextToken(lex, false)
-
-            if token.typ != itemLeftDelim {
-                parseErrorPrint(token, itemLeftDelim)
-            }
+    reportError(p, pos, fmt.Sprintf("assignment mismatch: %s but %s", plural(count, "variable"), plural(len(values), "value")))
+}
 
-            token = getNextToken(lex, false)
+// checkOperatorAssignment checks x op= y, which reads x as well as assigns
+// to it, so it takes exactly one operand on each side.
+func checkOperatorAssignment(assignment *AssignStmt, p *parser) {
+    if len(assignment.Lhs) != 1 || len(assignment.Rhs) != 1 {
+        reportError(p, assignment.pos, fmt.Sprintf("assignment operation %s requires single-valued expressions", operatorSpelling(assignment.Tok)))
 
-            variablesNode := declarationNode.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNode,
-                level: currentLevel + 2,
-                text: "Array's variables",
-            })
+        return
+    }
 
-            token = parseExpressions(tree, variablesNode, token, lex, currentLevel + 4)
+    checkTargets(assignment.Lhs, false, p)
+}
 
-            if token.typ != itemRightDelim {
-                parseErrorPrint(token, itemRightDelim)
+// checkTargets reports the expressions of targets that cannot be assigned
+// to: anything but a variable, an index expression, a field selector or a
+// pointer indirection. The blank identifier is only a target when blank is
+// set, as it has no value to update.
+func checkTargets(targets []Expr, blank bool, p *parser) {
+    for _, x := range targets {
+        switch x := x.(type) {
+        case *Ident:
+            if x.Name == "_" && !blank {
+                reportError(p, x.pos, "cannot use _ as value")
             }
-
-            return getNextToken(lex, false)
-        } else {
-            parseErrorPrint(token, itemChar)
+        case *IndexExpr, *SelectorExpr, *StarExpr:
+        default:
+            reportError(p, x.Pos(), fmt.Sprintf("cannot assign to %s", p.lex.input[x.Pos():x.End()]))
         }
     }
+}
 
-    if token.val == "[" && token.typ == itemChar {
-        indexNode := identifierNode.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNode,
-                level: currentLevel,
-                text: "itemArraySize",
-                data: token.val,
-        })
+// plural spells a count of things, e.g. "1 value" or "2 values".
+func plural(n int, thing string) string {
+    if n == 1 {
+        return fmt.Sprintf("%d %s", n, thing)
+    }
+
+    return fmt.Sprintf("%d %ss", n, thing)
+}
+
+// declareShort records the names that a short variable declaration adds to
+// the current block. The others are assigned to, and at least one of them
+// must be new.
+func declareShort(assignment *AssignStmt, p *parser) {
+    for _, x := range assignment.Lhs {
+        name, ok := x.(*Ident)
 
-        token = getNextToken(lex, false)
+        if !ok {
+            reportError(p, x.Pos(), "non-name on left side of :=")
 
-        token = parseSimpleExpression(tree, indexNode, token, lex, currentLevel + 2)
+            continue
+        }
 
-        if token.val != "]" || token.typ != itemChar {
-            parseErrorPrint(token, itemChar)
+        if name.Name == "_" || p.scope.lookupLocal(name.Name) != nil {
+            continue
         }
 
-        token = getNextToken(lex, false)
+        if declaresTwice(assignment.Declared, name) {
+            reportError(p, name.pos, name.Name + " repeated on left side of :=")
 
-        if token.typ == itemIntType || token.typ == itemStringType || token.typ == itemBoolType || token.typ == itemByteType {
-            declarationNode.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemVariableType,
-                level: currentLevel + 2,
-                text: "Variable type",
-                data: token.val,
-            })
-        } else {
-            parseErrorPrint(token, itemVariableType)
+            continue
         }
 
-        return getNextToken(lex, false)
+        assignment.Declared = append(assignment.Declared, name)
     }
 
-    parseErrorPrint(token, itemVariableType)
+    if len(assignment.Declared) == 0 {
+        reportError(p, assignment.pos, "no new variables on left side of :=")
+    }
 
-    return token
+    for _, name := range assignment.Declared {
+        p.scope.declare(name)
+    }
 }
 
-func parseInstructionExpression(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ == itemIdentifier {
-        expressionNode := node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNode,
-                level: currentLevel,
-                text: "Expression",
-        })
-        childNode := expressionNode.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemIdentifier,
-                level: currentLevel + 2,
-                text: "Identifier",
-                data: token.val,
-        })
-
-        token = parseExtendedFactor(tree, childNode, token, lex, currentLevel + 2)
+func declaresTwice(names []*Ident, name *Ident) bool {
+    for _, declared := range names {
+        if declared.Name == name.Name {
+            return true
+        }
+    }
 
-        if token.typ == itemAssign {
-            node.addChild(&AstTree{
-                    key: time.Now().String(),
-                    typ: itemAssign,
-                    level: currentLevel,
-                    text: "itemAssign",
-                    data: token.val,
-            })
+    return false
+}
 
-            token = getNextToken(lex, false)
+// builtinArguments holds the number of arguments of the builtins that take
+// a fixed number of them.
+var builtinArguments = map[string]int{
+    "panic":   1,
+    "recover": 0,
+}
 
-            token = parseExpression(tree, node, token, lex, currentLevel)
+// checkBuiltinCall reports calls to panic and recover with a wrong number of
+// arguments.
+func checkBuiltinCall(call *CallExpr, p *parser) {
+    for name, expected := range builtinArguments {
+        if !isBuiltin(call.Fun, name, p) || len(call.Args) == expected {
+            continue
         }
 
-        return token
-    }
+        problem := "not enough"
 
-    parseErrorPrint(token, itemIdentifier)
+        if len(call.Args) > expected {
+            problem = "too many"
+        }
 
-    return token
+        reportError(p, call.pos, fmt.Sprintf("%s arguments for %s (expected %d, found %d)", problem, p.lex.input[call.pos:call.end], expected, len(call.Args)))
+    }
 }
 
-func parseExtendedLogicalExpression(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.typ == itemEqual || token.typ == itemGreater || token.typ == itemLower || token.typ == itemGreaterOrEqual || token.typ == itemLowerOrEqual || token.typ == itemNotEqual {
-        token = parseComparison(tree, node, token, lex, currentLevel)
-        token = parseSimpleExpression(tree, node, token, lex, currentLevel)
-        token = parseExtendedLogicalExpression(tree, node, token, lex, currentLevel)
+// parseExtendedFactor reads the index expressions, calls and selectors
+// that follow the operand x.
+func parseExtendedFactor(x Expr, token *item, p *parser) (Expr, *item) {
+    if token.typ == itemLeftBrack {
+        return parseIndexOrSlice(x, token, p)
     }
 
-    return token
-}
+    if token.typ == itemLeftParen {
+        call := &CallExpr{span: span{pos: x.Pos()}, Fun: x}
 
-func parseComparison(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.val == "==" && token.typ == itemEqual {
-        node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemEqual,
-            level: currentLevel,
-            text: "itemEqual",
-            data: token.val,
-        })
+        p.exprLevel++
 
-        token = getNextToken(lex, false)
-    }
+        if isBuiltin(x, "new", p) {
+            // the argument of new is a type
+            var typ Expr
 
-    if token.val == "!=" && token.typ == itemNotEqual {
-        node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemNotEqual,
-            level: currentLevel,
-            text: "itemNotEqual",
-            data: token.val,
-        })
+            typ, token = parseType(getNextToken(p), p)
+            call.Args = []Expr{typ}
+        } else {
+            call.Args, call.Ellipsis, token = functionParameter(getNextToken(p), p)
+        }
 
-        token = getNextToken(lex, false)
-    }
+        p.exprLevel--
 
-    if token.val == ">" && token.typ == itemGreater {
-        node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemGreater,
-            level: currentLevel,
-            text: "itemGreater",
-            data: token.val,
-        })
+        if token.typ != itemRightParen {
+            parseError(p, token, itemRightParen)
+        }
+
+        call.end = token.end
+        checkBuiltinCall(call, p)
 
-        token = getNextToken(lex, false)
+        return parseExtendedFactor(call, getNextToken(p), p)
     }
 
-    if token.val == "<" && token.typ == itemLower {
-        node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemLower,
-            level: currentLevel,
-            text: "itemLower",
-            data: token.val,
-        })
+    if token.typ == itemDot {
+        token = getNextToken(p)
+
+        if token.typ == itemIdentifier {
+            // a selector split after the dot, the lexer inserts no
+            // semicolon there and the name starts the next line
+            name := newIdent(token)
+            selector := &SelectorExpr{span: span{pos: x.Pos(), end: name.end}, X: x, Sel: name}
+
+            return parseExtendedFactor(selector, getNextToken(p), p)
+        }
 
-        token = getNextToken(lex, false)
+        return parseTypeAssertion(x, token, p)
     }
 
-    if token.val == ">=" && token.typ == itemGreaterOrEqual {
-        node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemGreaterOrEqual,
-            level: currentLevel,
-            text: "itemGreaterOrEqual",
-            data: token.val,
-        })
+    if token.typ == itemLeftDelim && isLiteralType(x, p) {
+        literal, token := parseCompositeLiteral(x, nil, token, p)
 
-        token = getNextToken(lex, false)
+        return parseExtendedFactor(literal, token, p)
     }
 
-    if token.val == "<=" && token.typ == itemLowerOrEqual {
-        node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemLowerOrEqual,
-            level: currentLevel,
-            text: "itemLowerOrEqual",
-            data: token.val,
-        })
+    if token.typ == itemFunction || token.typ == itemField {
+        // the lexer keeps the dot in front of the field name
+        name := &Ident{span: span{pos: token.pos + 1, end: token.end}, Name: token.val[1:]}
+        selector := &SelectorExpr{span: span{pos: x.Pos(), end: token.end}, X: x, Sel: name}
 
-        token = getNextToken(lex, false)
+        return parseExtendedFactor(selector, getNextToken(p), p)
     }
 
-    return token
+    return x, token
 }
 
-func parseSimpleExpression(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if (token.val == "-") && (token.typ == itemMinus) {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemMinus,
-                level: currentLevel,
-                text: "itemMinus",
-                data: token.val,
-        })
+// parseIndexOrSlice reads the index expression x[i] or one of the slice
+// expressions x[lo:hi] and x[lo:hi:max]. token is the "[".
+func parseIndexOrSlice(x Expr, token *item, p *parser) (Expr, *item) {
+    var index [3]Expr
+    colons := 0
 
-        token = getNextToken(lex, false)
+    p.exprLevel++
+    token = getNextToken(p)
+
+    if token.typ != itemColon {
+        index[0], token = parseExpression(token, p)
     }
 
-    token = parseTerm(tree, node, token, lex, currentLevel)
-    token = parseExtendedSimpleExpression(tree, node, token, lex, currentLevel)
+    for token.typ == itemColon && colons < 2 {
+        colons++
+        token = getNextToken(p)
 
-    return token
-}
+        if token.typ != itemColon && token.typ != itemRightBrack {
+            index[colons], token = parseExpression(token, p)
+        }
+    }
 
-func parseExtendedSimpleExpression(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if (token.val == "-") && (token.typ == itemMinus) {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemMinus,
-                level: currentLevel,
-                text: "itemMinus",
-                data: token.val,
-        })
+    p.exprLevel--
+
+    if token.typ != itemRightBrack {
+        parseError(p, token, itemRightBrack)
+    }
 
-        token = getNextToken(lex, false)
+    if colons == 0 {
+        indexExpr := &IndexExpr{span: span{pos: x.Pos(), end: token.end}, X: x, Index: index[0]}
 
-        token = parseTerm(tree, node, token, lex, currentLevel)
+        return parseExtendedFactor(indexExpr, getNextToken(p), p)
     }
 
-    if (token.val == "+") && (token.typ == itemPlus) {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemPlus,
-                level: currentLevel,
-                text: "itemPlus",
-                data: token.val,
-        })
+    slice := &SliceExpr{span: span{pos: x.Pos(), end: token.end}, X: x, Low: index[0], High: index[1], Max: index[2], Slice3: colons == 2}
 
-        token = getNextToken(lex, false)
+    if slice.Slice3 && slice.High == nil {
+        reportError(p, token.pos, "middle index required in 3-index slice")
+    }
 
-        token = parseTerm(tree, node, token, lex, currentLevel)
+    if slice.Slice3 && slice.Max == nil {
+        reportError(p, token.pos, "final index required in 3-index slice")
     }
 
-    return token
+    return parseExtendedFactor(slice, getNextToken(p), p)
 }
 
-func parseTerm(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    token = parseFactor(tree, node, token, lex, currentLevel)
-    token = parseExtendedTerm(tree, node, token, lex, currentLevel)
+// isBuiltin reports whether x names the predeclared function name, which
+// no declaration of the program hides.
+func isBuiltin(x Expr, name string, p *parser) bool {
+    ident, ok := x.(*Ident)
 
-    return token
+    return ok && ident.Name == name && predeclared[name] == predeclaredFunction && p.scope.lookup(name) == nil
 }
 
-func parseExtendedTerm(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.val == "*" && token.typ == itemMupltiply {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemMupltiply,
-                level: currentLevel,
-                text: "itemMupltiply",
-                data: token.val,
-        })
-
-        token = getNextToken(lex, false)
-
-        token = parseFactor(tree, node, token, lex, currentLevel)
-        token = parseExtendedTerm(tree, node, token, lex, currentLevel)
+// parseTypeAssertion reads the parenthesized part of x.(T), or of x.(type)
+// in the header of a type switch.
+func parseTypeAssertion(x Expr, token *item, p *parser) (Expr, *item) {
+    if token.typ != itemLeftParen {
+        parseError(p, token, itemLeftParen)
     }
 
-    if token.val == "/" && token.typ == itemDivide {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemDivide,
-                level: currentLevel,
-                text: "itemDivide",
-                data: token.val,
-        })
+    assertion := &TypeAssertExpr{span: span{pos: x.Pos()}, X: x}
 
-        token = getNextToken(lex, false)
+    token = getNextToken(p)
 
-        token = parseFactor(tree, node, token, lex, currentLevel)
-        token = parseExtendedTerm(tree, node, token, lex, currentLevel)
+    if token.typ == itemTypeDefine {
+        token = getNextToken(p)
+    } else {
+        assertion.Type, token = parseType(token, p)
     }
 
-    if token.val == "%" {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemRest,
-                level: currentLevel,
-                text: "itemRest",
-                data: token.val,
-        })
-
-        token = getNextToken(lex, false)
-
-        token = parseFactor(tree, node, token, lex, currentLevel)
-        token = parseExtendedTerm(tree, node, token, lex, currentLevel)
+    if token.typ != itemRightParen {
+        parseError(p, token, itemRightParen)
     }
 
-    return token
+    assertion.end = token.end
+
+    return parseExtendedFactor(assertion, getNextToken(p), p)
 }
 
-func parseFactor(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.val == "-" && token.typ == itemMinus {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemChar,
-                level: currentLevel,
-                text: "itemNot",
-        })
+// functionParameter reads the arguments of a call up to the closing ")",
+// which is returned, with the position of the ... that may follow the last
+// one.
+func functionParameter(token *item, p *parser) ([]Expr, Pos, *item) {
+    var arguments []Expr
+    var ellipsis Pos
 
-        token = getNextToken(lex, false)
+    // a comma may follow the last argument, it is required when the ")" is
+    // on a line of its own
+    for token.typ != itemRightParen {
+        var x Expr
 
-        return token
-    }
+        x, token = parseExpression(token, p)
+        arguments = append(arguments, x)
 
-    if token.typ == itemIdentifier {
-        childNode := node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemIdentifier,
-                level: currentLevel,
-                text: "Identifier",
-                data: token.val,
-        })
+        if token.typ == itemEllipsis {
+            ellipsis = token.pos
+            token = getNextToken(p)
+
+            if token.typ == itemComma {
+                token = getNextToken(p)
+            }
 
-        token = parseExtendedFactor(tree, childNode, token, lex, currentLevel)
+            break
+        }
 
-        return token
+        if token.typ != itemComma {
+            break
+        }
+
+        token = getNextToken(p)
     }
 
-    if token.typ == itemBool {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemBool,
-                level: currentLevel,
-                text: "Boolean",
-                data: token.val,
-        })
+    return arguments, ellipsis, token
+}
 
-        token = getNextToken(lex, false)
+// parseTargets reads the expressions before the operator of a simple
+// statement. The names that stand alone are returned in names rather than
+// resolved, a := may declare them.
+func parseTargets(list []Expr, names []*Ident, token *item, p *parser) ([]Expr, []*Ident, *item) {
+    var x Expr
 
-        return token
-    }
+    if token.typ == itemIdentifier {
+        name := newIdent(token)
+        token = getNextToken(p)
 
-    if token.typ == itemNumber {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNumber,
-                level: currentLevel,
-                text: "Number",
-                data: token.val,
-        })
+        if token.typ == itemComma || token.typ == itemDeclare {
+            x = name
+            names = append(names, name)
+        } else {
+            resolve(name, p)
+            x, token = parseExtendedFactor(name, token, p)
+            x, token = parseBinaryOperators(1, x, token, p)
+        }
+    } else {
+        x, token = parseExpression(token, p)
+    }
 
-        token = getNextToken(lex, false)
+    list = append(list, x)
 
-        return token
+    if token.typ == itemComma {
+        return parseTargets(list, names, getNextToken(p), p)
     }
 
-    if token.typ == itemString {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemString,
-                level: currentLevel,
-                text: "itemString",
-                data: token.val,
-        })
+    return list, names, token
+}
 
-        token = getNextToken(lex, false)
+func parseExpressions(list []Expr, token *item, p *parser) ([]Expr, *item)  {
+    x, token := parseExpression(token, p)
+    list = append(list, x)
 
-        return token
+    if token.typ == itemComma {
+        return parseExpressions(list, getNextToken(p), p)
     }
 
-    if token.val == "(" && token.typ == itemLeftParen {
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemLeftParen,
-                level: currentLevel,
-                text: "itemLeftParen",
-                data: token.val,
-        })
+    return list, token
+}
 
-        token = getNextToken(lex, false)
+func getNextToken(p *parser) *item {
+  token := p.lex.NextToken()
 
-        token = parseExpression(tree, node, token, lex, currentLevel)
+  // newlines that do not end a statement carry no meaning for the grammar,
+  // the ones that do arrive as itemSemiColon
+  for ;token.typ == itemSpace || token.typ == itemComment || token.typ == itemNewLine || token.typ == itemError; {
+    if token.typ == itemError {
+      reportError(p, token.pos, token.val)
+    }
 
-        if token.val != ")" || token.typ != itemRightParen {
-            parseErrorPrint(token, itemRightParen)
-        }
+    token = p.lex.NextToken()
+  }
 
-        node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemRightParen,
-                level: currentLevel,
-                text: "itemRightParen",
-                data: token.val,
-        })
+  return &token
+}
 
-        token = getNextToken(lex, false)
+// parseSemiColon consumes the semicolon that terminates a statement or a
+// declaration. Like in Go it may be left out before a closing ")" or "}".
+func parseSemiColon(token *item, p *parser) *item {
+    if token.typ == itemSemiColon {
+        return getNextToken(p)
+    }
 
-        return token
+    if token.typ != itemRightParen && token.typ != itemRightDelim && token.typ != itemEOF {
+        parseError(p, token, itemSemiColon)
     }
 
-    fmt.Println(token.val)
-    fmt.Println(valuesTranslations[int(token.typ)])
+    return token
+}
 
-    token = getNextToken(lex, false)
+// describeToken spells token the way it should appear in a diagnostic.
+func describeToken(token *item) string {
+    if token.typ == itemEOF {
+        return "EOF"
+    }
 
-//// NOTE: Сделать вывод ошибок
-//
-    parseErrorPrint(token, itemNumber)
+    if token.typ == itemSemiColon && token.val == "\n" {
+        return "newline"
+    }
 
-    return token
+    return token.val
 }
 
-func parseExtendedFactor(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    token = getNextToken(lex, false)
+// expectedSpellings names the tokens a syntax error can expect that have no
+// spelling of their own. The others are spelled as in the source.
+var expectedSpellings = map[itemType]string{
+    itemIdentifier:     "name",
+    itemFunctionName:   "name",
+    itemNumber:         "expression",
+    itemVariableType:   "type",
+    itemFunctionDefine: "func",
+    itemPackage:        "package",
+    itemPackageValue:   "package name",
+    itemString:         "import path",
+}
 
-    if token.val == "[" && token.typ == itemChar {
-        indexNode := node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNode,
-                level: currentLevel,
-                text: "itemIndex",
-                data: token.val,
-        })
+// parseError records a syntax error at token, which is not the expected
+// one, and abandons the statement or declaration being parsed.
+func parseError(p *parser, token *item, expected itemType) {
+    spelling, ok := expectedSpellings[expected]
 
-        token = getNextToken(lex, false)
+    if !ok {
+        spelling = operatorSpelling(expected)
+    }
 
-        token = parseSimpleExpression(tree, indexNode, token, lex, currentLevel + 2)
+    syntaxError(p, token, fmt.Sprintf("unexpected %s, expecting %s", describeToken(token), spelling))
+}
 
-        if token.val != "]" || token.typ != itemChar {
-            parseErrorPrint(token, itemChar)
-        }
+// syntaxError records a syntax error at token and abandons the statement or
+// declaration being parsed. Only the first syntax error of a line is kept,
+// the others are usually caused by it. Other errors of the line do not
+// hide it.
+func syntaxError(p *parser, token *item, msg string) {
+    position := p.lex.file.Position(token.pos)
 
-        token = getNextToken(lex, false)
+    if p.syntaxLine != position.Line {
+        p.syntaxLine = position.Line
+        p.diagnostics.Add(position, "syntax error: " + msg)
     }
 
-    if token.val == "(" && token.typ == itemLeftParen {
-        functionParametersNode := node.addChild(&AstTree{
-                key: time.Now().String(),
-                typ: itemNode,
-                level: currentLevel + 4,
-                text: "Function parameters",
-        })
+    panic(bailout{token})
+}
 
-        token = getNextToken(lex, false)
+// reportError records an error at pos that does not prevent reading the
+// rest of the construct.
+func reportError(p *parser, pos Pos, msg string) {
+    p.diagnostics.Add(p.lex.file.Position(pos), msg)
+}
 
-        token = functionParameter(tree, functionParametersNode, token, lex, currentLevel + 6)
+// guard runs parse, which reads one statement or declaration. If parse bails
+// out on a syntax error, the tokens up to the next statement or declaration
+// are skipped by synchronize and failed is set, so that the caller can put a
+// Bad node in place of the broken one.
+func guard(p *parser, synchronize func(*parser, *item) *item, parse func() *item) (token *item, failed bool) {
+    scope, exprLevel, function := p.scope, p.exprLevel, p.function
 
-        if token.val != ")" || token.typ != itemRightParen {
-            parseErrorPrint(token, itemRightParen)
-        }
+    defer func() {
+        if r := recover(); r != nil {
+            failure, ok := r.(bailout)
 
-        token = getNextToken(lex, false)
-    }
+            if !ok {
+                panic(r)
+            }
 
-    if token.typ == itemFunction {
-        childNode := node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemFunction,
-            level: currentLevel + 2,
-            text: "Function of identifier",
-            data: token.val,
-        })
+            // blocks and function literals left by the panic are closed
+            p.scope, p.exprLevel, p.function = scope, exprLevel, function
+            token = synchronize(p, failure.token)
+            failed = true
+        }
+    }()
 
-        token = parseExtendedFactor(tree, childNode, token, lex, currentLevel)
-    }
+    return parse(), false
+}
 
-    if token.typ == itemField {
-        childNode := node.addChild(&AstTree{
-            key: time.Now().String(),
-            typ: itemField,
-            level: currentLevel + 2,
-            text: "Field of identifier",
-            data: token.val,
-        })
+// synchronizeInstruction skips to the end of the broken statement: the next
+// semicolon or the "}" of the enclosing block, neither of them consumed.
+func synchronizeInstruction(p *parser, token *item) *item {
+    depth := 0
 
-        token = parseExtendedFactor(tree, childNode, token, lex, currentLevel)
+    for token.typ != itemEOF {
+        switch {
+        case token.typ == itemLeftDelim:
+            depth++
+        case token.typ == itemRightDelim && depth == 0:
+            return token
+        case token.typ == itemRightDelim:
+            depth--
+        case token.typ == itemSemiColon && depth == 0:
+            return token
+        }
+
+        token = getNextToken(p)
     }
 
     return token
 }
 
-func functionParameter(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item {
-    if token.val == ")" && token.typ == itemRightParen {
-        return token
-    }
+// synchronizeDeclaration skips to the start of the next top level
+// declaration.
+func synchronizeDeclaration(p *parser, token *item) *item {
+    depth := 0
+
+    for token.typ != itemEOF {
+        switch token.typ {
+        case itemLeftDelim, itemLeftParen:
+            depth++
+        case itemRightDelim, itemRightParen:
+            depth--
+        case itemSemiColon:
+            if depth <= 0 {
+                next := getNextToken(p)
+
+                if startsDeclaration(next) {
+                    return next
+                }
 
-    return parseExpressions(tree, node, token, lex, currentLevel)
-}
+                token = next
+                depth = 0
 
-func parseExpressions(tree *AstTree, node *AstTree, token *item, lex * lexer, currentLevel int) *item  {
-    token = parseExpression(tree, node, token, lex, currentLevel)
+                continue
+            }
+        }
 
-    if token.val == "," && token.typ == itemChar {
-        token = getNextToken(lex, false)
-        token = parseExpressions(tree, node, token, lex, currentLevel)
+        token = getNextToken(p)
     }
 
     return token
 }
 
-func getNextToken(lex *lexer, skipNewLine bool) *item {
-  token := <-lex.items
-
-  if skipNewLine == true {
-    for ;token.typ == itemSpace || token.typ == itemComment || token.typ == itemNewLine; {
-      token = <-lex.items
-    }
-  } else {
-    for ;token.typ == itemSpace || token.typ == itemComment; {
-      token = <-lex.items
+// startsDeclaration reports whether token can begin a top level declaration.
+func startsDeclaration(token *item) bool {
+    switch token.typ {
+    case itemEOF, itemFunctionDefine, itemImport, itemVar, itemConst, itemTypeDefine:
+        return true
     }
-  }
-
-  return &token
-}
 
-func parseErrorPrint(token *item, item itemType) {
-    fmt.Println(token.line, ":", token.pos,"syntax error: unexpected", token.val, ", expecting", valuesTranslations[int(item)])
-  // fmt.Println("There should be", valuesTranslations[int(item)], "<", token.pos, ">", "line:", token.line, "got:", valuesTranslations[int(token.typ)])
-  os.Exit(1)
+    return false
 }
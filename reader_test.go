@@ -0,0 +1,1380 @@
+package main
+
+import (
+    "fmt"
+    "io/ioutil"
+    "strings"
+    "testing"
+)
+
+// expectDiagnostics parses source and checks that it reports exactly the
+// expected diagnostics, in order.
+func expectDiagnostics(t *testing.T, source string, expected []string) *File {
+    t.Helper()
+
+    tree, diagnostics := parse(newLexer("t.go", source))
+
+    if len(diagnostics) != len(expected) {
+        t.Fatal("Expected", len(expected), "diagnostics got", diagnostics)
+    }
+
+    for i, diagnostic := range diagnostics {
+        if diagnostic.Error() != expected[i] {
+            t.Error("Expected", expected[i], "got", diagnostic)
+        }
+    }
+
+    return tree
+}
+
+func TestParseSamples(t *testing.T) {
+    for _, filename := range []string{"testFiles/NOD.go", "testFiles/maxElement.go", "testFiles/substring.go"} {
+        data, err := ioutil.ReadFile(filename)
+
+        if err != nil {
+            t.Fatal(err)
+        }
+
+        if _, diagnostics := parse(newLexer(filename, string(data))); len(diagnostics) != 0 {
+            t.Error("Expected no diagnostics for", filename, "got", diagnostics)
+        }
+    }
+}
+
+func countBadRegions(tree *File) int {
+    count := 0
+
+    Inspect(tree, func(node Node) bool {
+        switch node.(type) {
+        case *BadStmt, *BadDecl, *BadExpr:
+            count++
+        }
+
+        return true
+    })
+
+    return count
+}
+
+func TestParseRecovery(t *testing.T) {
+    source := "package main\n" +
+        "func main() {\n" +
+        "    var x int = 1 +\n" +
+        "    var y string = \"abc\n" +
+        "    x = 2\n" +
+        "}\n" +
+        "func other( {\n" +
+        "}\n" +
+        "func third() {\n" +
+        "    var z int = 0x\n" +
+        "}\n"
+    tree := expectDiagnostics(t, source, []string{
+        "t.go:4:5: syntax error: unexpected var, expecting expression",
+        "t.go:4:20: unterminated quoted string",
+        "t.go:7:13: syntax error: unexpected {, expecting )",
+        "t.go:10:17: hexadecimal literal has no digits",
+    })
+
+    if count := countBadRegions(tree); count != 2 {
+        t.Error("Expected 2 bad regions got", count)
+    }
+
+    if decls := len(tree.Decls); decls != 3 {
+        t.Error("Expected 2 functions and a bad declaration got", decls, "declarations")
+    }
+
+    source = "package main\n" +
+        "func main() {\n" +
+        "    _++; x = )\n" +
+        "    a := 1; a := 2; y = )\n" +
+        "    z := 0x; w = )\n" +
+        "}\n"
+    expectDiagnostics(t, source, []string{
+        "t.go:3:5: cannot use _ as value",
+        "t.go:3:14: syntax error: unexpected ), expecting expression",
+        "t.go:4:13: no new variables on left side of :=",
+        "t.go:4:25: syntax error: unexpected ), expecting expression",
+        "t.go:5:10: hexadecimal literal has no digits",
+        "t.go:5:18: syntax error: unexpected ), expecting expression",
+    })
+
+    for _, pair := range syntaxErrorTests {
+        _, diagnostics := parse(newLexer("t.go", pair.source))
+
+        if len(diagnostics) == 0 || diagnostics[0].Error() != pair.expected {
+            t.Error("Expected", pair.expected, "for", pair.source, "got", diagnostics)
+        }
+    }
+}
+
+type errorPair struct {
+    source string
+    expected string
+}
+
+var syntaxErrorTests = []errorPair{
+    { "package", "t.go:1:8: syntax error: unexpected EOF, expecting package name" },
+    { "package main\nimport x\n", "t.go:2:9: syntax error: unexpected newline, expecting import path" },
+    { "package main\nmain()\n", "t.go:2:1: syntax error: unexpected main, expecting func" },
+    { "package main\nfunc main() {\n    goto 1\n}\n", "t.go:3:10: syntax error: unexpected 1, expecting name" },
+    { "package main\nfunc main() {\n    switch {\n    case true x\n    }\n}\n", "t.go:4:15: syntax error: unexpected x, expecting :" },
+    { "package main\nfunc main() {\n    f(1\n}\n", "t.go:3:8: syntax error: unexpected newline, expecting )" },
+}
+
+func TestTypedTree(t *testing.T) {
+    source := "package main\n" +
+        "func main() {\n" +
+        "    var a [2]int = [2]int{1, 2}\n" +
+        "    if a[0] < 2 {\n" +
+        "        fmt.Println(a[1] + 1)\n" +
+        "    }\n" +
+        "}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    body := tree.Decls[0].(*FuncDecl).Body
+
+    declaration, ok := body.List[0].(*VarDecl)
+
+    if !ok || declaration.Names[0].Name != "a" {
+        t.Fatal("Expected a var declaration of a got", nodeName(body.List[0]))
+    }
+
+    if _, ok := declaration.Type.(*ArrayType); !ok {
+        t.Error("Expected an array type got", nodeName(declaration.Type))
+    }
+
+    if literal, ok := declaration.Values[0].(*CompositeLit); !ok || len(literal.Elts) != 2 {
+        t.Error("Expected a composite literal with 2 elements got", nodeName(declaration.Values[0]))
+    }
+
+    structure := body.List[1].(*IfStmt)
+
+    if condition, ok := structure.Cond.(*BinaryExpr); !ok || condition.Op != itemLower {
+        t.Fatal("Expected a < comparison got", nodeName(structure.Cond))
+    }
+
+    call := structure.Body.List[0].(*ExprStmt).X.(*CallExpr)
+
+    if selector, ok := call.Fun.(*SelectorExpr); !ok || selector.Sel.Name != "Println" {
+        t.Error("Expected a call of fmt.Println got", nodeName(call.Fun))
+    }
+
+    if sum, ok := call.Args[0].(*BinaryExpr); !ok || sum.Op != itemPlus {
+        t.Error("Expected a sum as argument got", nodeName(call.Args[0]))
+    } else if _, ok := sum.X.(*IndexExpr); !ok {
+        t.Error("Expected an index expression got", nodeName(sum.X))
+    }
+
+    if source[structure.Pos():structure.End()] != "if a[0] < 2 {\n        fmt.Println(a[1] + 1)\n    }" {
+        t.Error("Unexpected range of the if statement", structure.Pos(), structure.End())
+    }
+}
+
+func TestImports(t *testing.T) {
+    source := "package main\n" +
+        "import \"fmt\"\n" +
+        "import f \"fmt\"\n" +
+        "import (\n" +
+        "    . \"strings\"; _ \"x\"\n" +
+        "    `raw`\n" +
+        ")\n" +
+        "import ()\n" +
+        "func main() {\n" +
+        "}\n"
+    expected := [][2]string{{"", `"fmt"`}, {"f", `"fmt"`}, {".", `"strings"`}, {"_", `"x"`}, {"", "`raw`"}}
+
+    tree := expectDiagnostics(t, source, nil)
+
+    if len(tree.Imports) != len(expected) {
+        t.Fatal("Expected", len(expected), "imports got", len(tree.Imports))
+    }
+
+    for i, spec := range tree.Imports {
+        name := ""
+
+        if spec.Name != nil {
+            name = spec.Name.Name
+        }
+
+        if name != expected[i][0] || spec.Path.Text != expected[i][1] {
+            t.Error("Expected import", expected[i], "got", name, spec.Path.Text)
+        }
+    }
+
+    if len(tree.Decls) != 1 {
+        t.Error("Expected only the main function got", len(tree.Decls), "declarations")
+    }
+}
+
+func TestShortDeclarations(t *testing.T) {
+    source := "package main\n" +
+        "func div(x int, y int) (int, int) {\n" +
+        "    q, r := x / y, x % y\n" +
+        "    r, s := r, 2\n" +
+        "    _, q = q, 1\n" +
+        "    if q > r {\n" +
+        "        q, r = r, q\n" +
+        "        q := 3\n" +
+        "    }\n" +
+        "    _ = s\n" +
+        "    return q, r\n" +
+        "}\n"
+    expected := []string{"q r", "s", "", "", "q", ""}
+
+    tree := expectDiagnostics(t, source, nil)
+
+    var declared []string
+
+    Inspect(tree, func(node Node) bool {
+        if assignment, ok := node.(*AssignStmt); ok {
+            var names []string
+
+            for _, name := range assignment.Declared {
+                names = append(names, name.Name)
+            }
+
+            declared = append(declared, strings.Join(names, " "))
+        }
+
+        return true
+    })
+
+    if strings.Join(declared, ",") != strings.Join(expected, ",") {
+        t.Error("Expected declared names", expected, "got", declared)
+    }
+
+    swap := tree.Decls[0].(*FuncDecl).Body.List[3].(*IfStmt).Body.List[0].(*AssignStmt)
+
+    if swap.Tok != itemAssign || len(swap.Lhs) != 2 || len(swap.Rhs) != 2 {
+        t.Error("Expected a tuple assignment got", len(swap.Lhs), "=", len(swap.Rhs))
+    }
+
+    errors := "package main\n" +
+        "func main() {\n" +
+        "    a := 1\n" +
+        "    a := 2\n" +
+        "    _ := 3\n" +
+        "    b, b := 4, 5\n" +
+        "    a[0], c := 6, 7\n" +
+        "    a, c = 8\n" +
+        "    a, c = f()\n" +
+        "}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:4:5: no new variables on left side of :=",
+        "t.go:5:5: no new variables on left side of :=",
+        "t.go:6:8: b repeated on left side of :=",
+        "t.go:7:5: non-name on left side of :=",
+        "t.go:8:5: assignment mismatch: 2 variables but 1 value",
+    })
+}
+
+func TestIncDecAndOperatorAssignment(t *testing.T) {
+    source := "package main\n" +
+        "func main() {\n" +
+        "    i++\n" +
+        "    a[i]--\n" +
+        "    i += 2\n" +
+        "    s.n <<= 1\n" +
+        "    a[0] &^= i * 2\n" +
+        "}\n"
+    expected := []string{"IncDecStmt ++", "IncDecStmt --", "AssignStmt +=", "AssignStmt <<=", "AssignStmt &^="}
+
+    tree := expectDiagnostics(t, source, nil)
+
+    for i, statement := range tree.Decls[0].(*FuncDecl).Body.List {
+        if got := nodeName(statement) + " " + nodeValue(statement); got != expected[i] {
+            t.Error("Expected", expected[i], "got", got)
+        }
+    }
+
+    errors := "package main\n" +
+        "func main() {\n" +
+        "    f()++\n" +
+        "    a, b += 1, 2\n" +
+        "    _ -= 1\n" +
+        "    1 = x\n" +
+        "    a + b *= 2\n" +
+        "    _, a[0], s.f = 1, 2, 3\n" +
+        "}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:3:5: cannot assign to f()",
+        "t.go:4:5: assignment operation += requires single-valued expressions",
+        "t.go:5:5: cannot use _ as value",
+        "t.go:6:5: cannot assign to 1",
+        "t.go:7:5: cannot assign to a + b",
+    })
+}
+
+func TestForStatements(t *testing.T) {
+    source := "package main\n" +
+        "func main() {\n" +
+        "    for {\n    }\n" +
+        "    for i < n {\n    }\n" +
+        "    for i := 0; i < n; i++ {\n    }\n" +
+        "    for ; ; {\n    }\n" +
+        "    for i = 0; ; i += 2 {\n    }\n" +
+        "    for range a {\n    }\n" +
+        "    for i, v := range a {\n        sum += v * i\n    }\n" +
+        "    for i = range a {\n    }\n" +
+        "}\n"
+    // the children of every loop, "-" for a missing part
+    expected := []string{
+        "- - - BlockStmt",
+        "- BinaryExpr - BlockStmt",
+        "AssignStmt BinaryExpr IncDecStmt BlockStmt",
+        "- - - BlockStmt",
+        "AssignStmt - AssignStmt BlockStmt",
+        "range - - Ident BlockStmt",
+        "range Ident Ident Ident BlockStmt",
+        "range Ident - Ident BlockStmt",
+    }
+
+    tree := expectDiagnostics(t, source, nil)
+
+    name := func(node Node) string {
+        if node == nil || isNilNode(node) {
+            return "-"
+        }
+
+        return nodeName(node)
+    }
+
+    for i, statement := range tree.Decls[0].(*FuncDecl).Body.List {
+        got := ""
+
+        switch loop := statement.(type) {
+        case *ForStmt:
+            got = strings.Join([]string{name(loop.Init), name(loop.Cond), name(loop.Post), name(loop.Body)}, " ")
+        case *RangeStmt:
+            got = strings.Join([]string{"range", name(loop.Key), name(loop.Value), name(loop.X), name(loop.Body)}, " ")
+        }
+
+        if got != expected[i] {
+            t.Error("Expected", expected[i], "got", got)
+        }
+    }
+
+    errors := "package main\n" +
+        "func main() {\n" +
+        "    for i := 0; i < 3; j := 1 {\n    }\n" +
+        "    for a, b, c := range x {\n    }\n" +
+        "    for i := 0 {\n    }\n" +
+        "    for i := range a {\n        i := 1\n    }\n" +
+        "}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:3:24: cannot declare in post statement of for loop",
+        "t.go:5:15: range clause permits at most two iteration variables",
+        "t.go:7:16: syntax error: unexpected {, expecting ;",
+    })
+}
+
+func TestIfStatements(t *testing.T) {
+    source := "package main\n" +
+        "func main() {\n" +
+        "    if a {\n    } else if b {\n    } else if c {\n    } else {\n        x = 1\n    }\n" +
+        "    if v := f(); v > 0 {\n        v++\n    } else if w := v; w < 0 {\n        w--\n    }\n" +
+        "}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    body := tree.Decls[0].(*FuncDecl).Body
+    chain := body.List[0].(*IfStmt)
+    conditions := ""
+
+    for {
+        conditions += chain.Cond.(*Ident).Name
+
+        next, ok := chain.Else.(*IfStmt)
+
+        if !ok {
+            if last, ok := chain.Else.(*BlockStmt); !ok || len(last.List) != 1 {
+                t.Error("Expected the chain to end with the else block")
+            }
+
+            break
+        }
+
+        chain = next
+    }
+
+    if conditions != "abc" {
+        t.Error("Expected the conditions abc got", conditions)
+    }
+
+    withInit := body.List[1].(*IfStmt)
+
+    if _, ok := withInit.Init.(*AssignStmt); !ok {
+        t.Error("Expected an init statement got", withInit.Init)
+    }
+
+    if elseIf := withInit.Else.(*IfStmt); elseIf.Init == nil || elseIf.Else != nil {
+        t.Error("Expected an else-if with an init statement and no else")
+    }
+
+    if withInit.End() != body.List[1].(*IfStmt).Else.End() {
+        t.Error("Expected the if statement to end with its else branch")
+    }
+
+    errors := "package main\n" +
+        "func main() {\n" +
+        "    if x {\n    } else y = 1\n" +
+        "    if {\n    }\n" +
+        "    if x\n    {\n    }\n" +
+        "    if x y {\n    }\n" +
+        "    if a := 1 {\n    }\n" +
+        "}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:4:12: syntax error: else must be followed by if or statement block",
+        "t.go:5:8: missing condition in if statement",
+        "t.go:7:9: syntax error: unexpected newline, expecting { after if clause",
+        "t.go:10:10: syntax error: unexpected y, expecting { after if clause",
+        "t.go:12:15: syntax error: cannot use a := 1 as value",
+    })
+}
+
+func TestSwitchStatements(t *testing.T) {
+    source := "package main\n" +
+        "func main() {\n" +
+        "    switch {\n    case a > b:\n        a++\n        fallthrough\n    default:\n    }\n" +
+        "    switch x {\n    case 1, 2, 3:\n    case 4:\n        f()\n        g()\n    }\n" +
+        "    switch x := f(); x {\n    }\n" +
+        "    switch x := f(); {\n    default:\n        x++\n    }\n" +
+        "    switch v := y.(type) {\n    case int, nil:\n        v++\n    case string:\n    }\n" +
+        "    switch y.(type) {\n    }\n" +
+        "    switch p {\n    case P{1}:\n    }\n" +
+        "}\n"
+    // init, tag or guard, and the number of expressions and statements of
+    // every clause
+    expected := []string{
+        "- - 1:2 0:0",
+        "- Ident 3:0 1:2",
+        "AssignStmt Ident",
+        "AssignStmt - 0:1",
+        "type - AssignStmt 2:1 1:0",
+        "type - ExprStmt",
+        "- Ident 1:0",
+    }
+
+    tree := expectDiagnostics(t, source, nil)
+
+    name := func(node Node) string {
+        if node == nil || isNilNode(node) {
+            return "-"
+        }
+
+        return nodeName(node)
+    }
+
+    for i, statement := range tree.Decls[0].(*FuncDecl).Body.List {
+        var parts []string
+        var body *BlockStmt
+
+        switch structure := statement.(type) {
+        case *SwitchStmt:
+            parts = []string{name(structure.Init), name(structure.Tag)}
+            body = structure.Body
+        case *TypeSwitchStmt:
+            parts = []string{"type", name(structure.Init), name(structure.Assign)}
+            body = structure.Body
+        }
+
+        for _, clause := range body.List {
+            clause := clause.(*CaseClause)
+            parts = append(parts, fmt.Sprintf("%d:%d", len(clause.List), len(clause.Body)))
+        }
+
+        if got := strings.Join(parts, " "); got != expected[i] {
+            t.Error("Expected", expected[i], "got", got)
+        }
+    }
+
+    errors := "package main\n" +
+        "func main() {\n" +
+        "    switch x {\n    case 1:\n        fallthrough\n    }\n" +
+        "    switch x {\n    case 1:\n        fallthrough\n        f()\n    case 2:\n    }\n" +
+        "    switch y.(type) {\n    case int:\n        fallthrough\n    default:\n    }\n" +
+        "    switch {\n    default:\n    default:\n    }\n" +
+        "    if x {\n        fallthrough\n    }\n" +
+        "    z := y.(type)\n" +
+        "}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:5:9: cannot fallthrough final case in switch",
+        "t.go:9:9: fallthrough statement out of place",
+        "t.go:15:9: cannot fallthrough in type switch",
+        "t.go:20:5: multiple defaults in switch",
+        "t.go:23:9: fallthrough statement out of place",
+        "t.go:25:10: use of .(type) outside type switch",
+    })
+}
+
+func TestBranchStatements(t *testing.T) {
+    source := "package main\n" +
+        "func main() {\n" +
+        "outer:\n" +
+        "    for i := 0; i < 3; i++ {\n" +
+        "        switch {\n" +
+        "        case i == 1:\n            continue outer\n" +
+        "        case i == 2:\n            break outer\n" +
+        "        }\n" +
+        "        for {\n            break\n        }\n" +
+        "        goto end\n" +
+        "    }\n" +
+        "    switch {\n    default:\n        break\n    }\n" +
+        "end:\n" +
+        "}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    list := tree.Decls[0].(*FuncDecl).Body.List
+
+    if labeled, ok := list[0].(*LabeledStmt); !ok || labeled.Label.Name != "outer" {
+        t.Error("Expected the loop to be labeled got", nodeName(list[0]))
+    } else if _, ok := labeled.Stmt.(*ForStmt); !ok {
+        t.Error("Expected the label on the loop got", nodeName(labeled.Stmt))
+    }
+
+    if labeled, ok := list[2].(*LabeledStmt); !ok {
+        t.Error("Expected a label at the end of the body got", nodeName(list[2]))
+    } else if _, ok := labeled.Stmt.(*EmptyStmt); !ok {
+        t.Error("Expected the label to be on an empty statement got", nodeName(labeled.Stmt))
+    }
+
+    var branches []string
+
+    Inspect(tree, func(node Node) bool {
+        if branch, ok := node.(*BranchStmt); ok {
+            label := ""
+
+            if branch.Label != nil {
+                label = " " + branch.Label.Name
+            }
+
+            branches = append(branches, branchKeyword(branch.Tok) + label)
+        }
+
+        return true
+    })
+
+    if got := strings.Join(branches, ","); got != "continue outer,break outer,break,continue end,break" {
+        t.Error("Unexpected branch statements", got)
+    }
+
+    errors := "package main\n" +
+        "func main() {\n" +
+        "    break\n" +
+        "    switch {\n    default:\n        continue\n    }\n" +
+        "    goto missing\n" +
+        "a:\n" +
+        "    x++\n" +
+        "b:\n" +
+        "    for {\n        break a\n    }\n" +
+        "b:\n" +
+        "    x--\n" +
+        "c:\n" +
+        "    switch {\n    default:\n        continue c\n    }\n" +
+        "}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:3:5: break is not in a loop, switch, or select",
+        "t.go:6:9: continue is not in a loop",
+        "t.go:8:10: label missing not defined",
+        "t.go:11:1: label b defined and not used",
+        "t.go:13:15: invalid break label a",
+        "t.go:15:1: label b already defined at t.go:11:1",
+        "t.go:20:18: invalid continue label c",
+    })
+
+    // the statements dropped for a syntax error may hold labels and their
+    // uses
+    errors = "package main\n" +
+        "func f() {\n    for {\n        continue Match\n    }\n" +
+        "Match:\n    for x := ) {\n    }\n}\n" +
+        "func g() {\nL:\n    for {\n        break L )\n    }\n}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:7:14: syntax error: unexpected ), expecting expression",
+        "t.go:13:17: syntax error: unexpected ), expecting ;",
+    })
+}
+
+func TestTypeDeclarations(t *testing.T) {
+    source := "package main\n" +
+        "type Celsius float64\n" +
+        "type Temp = Celsius\n" +
+        "type Point struct {\n" +
+        "    X, Y int `json:\"x\"`\n" +
+        "    Name string\n" +
+        "    Celsius\n" +
+        "    sync.Mutex \"lock\"\n" +
+        "}\n" +
+        "var origin Point\n" +
+        "func main() {\n" +
+        "    type pair struct { a, b int }\n" +
+        "    p := Point{X: 1, Y: 2}\n" +
+        "    q := [2]Point{{1, 2}, {X: 3}}\n" +
+        "    if p == (Point{}) {\n        p.X = q[1].Y\n    }\n" +
+        "    for _, v := range [1]pair{} {\n    }\n" +
+        "    for p.X < origin.Y {\n    }\n" +
+        "    p.\n\t\tX = origin.\n        Y\n" +
+        "}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    if len(tree.Decls) != 5 {
+        t.Fatal("Expected 3 types, a variable and a function got", len(tree.Decls), "declarations")
+    }
+
+    if alias := tree.Decls[1].(*TypeDecl); !alias.Alias || alias.Type.(*Ident).Name != "Celsius" {
+        t.Error("Expected Temp to be an alias of Celsius")
+    }
+
+    structure := tree.Decls[2].(*TypeDecl).Type.(*StructType)
+    fields := []string{}
+
+    for _, field := range structure.Fields {
+        var names []string
+
+        for _, name := range field.Names {
+            names = append(names, name.Name)
+        }
+
+        typ := source[field.Type.Pos():field.Type.End()]
+        tag := ""
+
+        if field.Tag != nil {
+            tag = " " + field.Tag.Text
+        }
+
+        fields = append(fields, strings.Join(names, ",") + ":" + typ + tag)
+    }
+
+    if got := strings.Join(fields, " "); got != "X,Y:int `json:\"x\"` Name:string :Celsius :sync.Mutex \"lock\"" {
+        t.Error("Unexpected fields", got)
+    }
+
+    body := tree.Decls[4].(*FuncDecl).Body
+
+    if local, ok := body.List[0].(*TypeDecl); !ok || len(local.Type.(*StructType).Fields) != 1 {
+        t.Error("Expected a local struct type got", nodeName(body.List[0]))
+    }
+
+    point := body.List[1].(*AssignStmt).Rhs[0].(*CompositeLit)
+
+    if len(point.Elts) != 2 || point.Elts[0].(*KeyValueExpr).Key.(*Ident).Name != "X" {
+        t.Error("Expected the keyed elements X and Y")
+    }
+
+    array := body.List[2].(*AssignStmt).Rhs[0].(*CompositeLit)
+
+    if inner, ok := array.Elts[1].(*CompositeLit); !ok || inner.Type != nil || len(inner.Elts) != 1 {
+        t.Error("Expected an element literal without its type")
+    }
+
+    condition := body.List[3].(*IfStmt).Cond.(*BinaryExpr)
+
+    if _, ok := condition.Y.(*CompositeLit); !ok {
+        t.Error("Expected a parenthesized literal in the condition got", nodeName(condition.Y))
+    }
+
+    assignment := body.List[3].(*IfStmt).Body.List[0].(*AssignStmt)
+
+    if selector, ok := assignment.Rhs[0].(*SelectorExpr); !ok || selector.Sel.Name != "Y" {
+        t.Error("Expected the selector q[1].Y")
+    } else if _, ok := selector.X.(*IndexExpr); !ok {
+        t.Error("Expected the selector to apply to q[1]")
+    }
+
+    if loop := body.List[5].(*ForStmt); loop.Cond.(*BinaryExpr).Y.(*SelectorExpr).Sel.Name != "Y" || len(loop.Body.List) != 0 {
+        t.Error("Expected origin.Y { to end the loop header")
+    }
+
+    split := body.List[6].(*AssignStmt)
+
+    if target, ok := split.Lhs[0].(*SelectorExpr); !ok || target.Sel.Name != "X" || nodeName(split.Rhs[0]) != "SelectorExpr" {
+        t.Error("Expected the selectors p.X and origin.Y split after their dots")
+    }
+}
+
+func TestCompositeTypes(t *testing.T) {
+    source := "package main\n" +
+        "type node struct {\n    *node\n    next *node\n    kids []*node\n}\n" +
+        "func lookup(m map[string]*node, keys ...string) *[]int {\n" +
+        "    s := []int{1, 2, 3}[1:]\n" +
+        "    a := [...]string{2: \"c\", 0: \"a\"}\n" +
+        "    g := map[string][]int{\"x\": {1}, \"y\": nil}\n" +
+        "    p := &node{next: new(node)}\n" +
+        "    *p = node{}\n" +
+        "    p.next.kids = append(s[:1], s[1:2:3])\n" +
+        "    return new([]int)\n" +
+        "}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    fields := tree.Decls[0].(*TypeDecl).Type.(*StructType).Fields
+
+    if embedded, ok := fields[0].Type.(*StarExpr); !ok || len(fields[0].Names) != 0 || embedded.X.(*Ident).Name != "node" {
+        t.Error("Expected an embedded *node")
+    }
+
+    if slice := fields[2].Type.(*ArrayType); slice.Len != nil {
+        t.Error("Expected a slice type for kids")
+    }
+
+    function := tree.Decls[1].(*FuncDecl)
+
+    if mapType, ok := function.Params[0].Type.(*MapType); !ok || mapType.Key.(*Ident).Name != "string" {
+        t.Error("Expected a map parameter")
+    }
+
+    if _, ok := function.Results[0].Type.(*StarExpr); !ok {
+        t.Error("Expected a pointer result")
+    }
+
+    list := function.Body.List
+    value := func(i int) Expr {
+        return list[i].(*AssignStmt).Rhs[0]
+    }
+
+    if slice, ok := value(0).(*SliceExpr); !ok || slice.High != nil || slice.Slice3 {
+        t.Error("Expected the slice expression [1:] got", nodeName(value(0)))
+    } else if _, ok := slice.X.(*CompositeLit); !ok {
+        t.Error("Expected a slice of a composite literal")
+    }
+
+    if array := value(1).(*CompositeLit).Type.(*ArrayType); array.Len == nil {
+        t.Error("Expected [...]string to have a length")
+    } else if _, ok := array.Len.(*Ellipsis); !ok {
+        t.Error("Expected [...] as length got", nodeName(array.Len))
+    }
+
+    if element := value(2).(*CompositeLit).Elts[0].(*KeyValueExpr).Value; element.(*CompositeLit).Type != nil {
+        t.Error("Expected an element literal without its type")
+    }
+
+    if address := value(3).(*UnaryExpr); address.Op != itemAmpersand {
+        t.Error("Expected the address of a literal")
+    } else if call := address.X.(*CompositeLit).Elts[0].(*KeyValueExpr).Value.(*CallExpr); call.Args[0].(*Ident).Name != "node" {
+        t.Error("Expected new(node)")
+    }
+
+    if target := list[4].(*AssignStmt).Lhs[0]; nodeName(target) != "StarExpr" {
+        t.Error("Expected an assignment through a pointer got", nodeName(target))
+    }
+
+    args := value(5).(*CallExpr).Args
+
+    if slice := args[1].(*SliceExpr); !slice.Slice3 || slice.Max == nil {
+        t.Error("Expected the 3-index slice s[1:2:3]")
+    }
+
+    if array, ok := list[6].(*ReturnStmt).Results[0].(*CallExpr).Args[0].(*ArrayType); !ok || array.Len != nil {
+        t.Error("Expected the type []int as argument of new")
+    }
+
+    errors := "package main\n" +
+        "var a [...]int\n" +
+        "func main() {\n" +
+        "    s = s[1::3]\n" +
+        "    s = s[1:2:]\n" +
+        "    f() = 1\n" +
+        "}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:2:7: invalid use of [...] array (outside a composite literal)",
+        "t.go:4:15: middle index required in 3-index slice",
+        "t.go:5:15: final index required in 3-index slice",
+        "t.go:6:5: cannot assign to f()",
+    })
+}
+
+// fieldList spells parameters or results as name:type pairs.
+func fieldList(fields []*Field) string {
+    var list []string
+
+    for _, field := range fields {
+        typ := ""
+
+        switch x := field.Type.(type) {
+        case *Ident:
+            typ = x.Name
+        case *Ellipsis:
+            typ = "..." + x.Elt.(*Ident).Name
+        }
+
+        if len(field.Names) == 0 {
+            list = append(list, typ)
+        }
+
+        for _, name := range field.Names {
+            list = append(list, name.Name + ":" + typ)
+        }
+    }
+
+    return strings.Join(list, " ")
+}
+
+func TestFunctionSignatures(t *testing.T) {
+    source := "package main\n" +
+        "func a() {\n}\n" +
+        "func b(x, y int, s string) int {\n    return x\n}\n" +
+        "func c(int, string) (int, error) {\n    return 1, nil\n}\n" +
+        "func d(format string, args ...int) (n int, err error) {\n    return\n}\n" +
+        "func e(a, b) (x, y int,) {\n    return a + b, b\n}\n" +
+        "func f(s string, error string) {\n}\n" +
+        "func (any *T) g(int, error) {\n}\n" +
+        "func h(xs ...int) int {\n    return h(\n        xs...,\n    )\n}\n"
+    expected := [][2]string{
+        {"", ""},
+        {"x:int y:int s:string", "int"},
+        {"int string", "int error"},
+        {"format:string args:...int", "n:int err:error"},
+        {"a b", "x:int y:int"},
+        {"s:string error:string", ""},
+        {"int error", ""},
+        {"xs:...int", "int"},
+    }
+    results := []int{0, 1, 2, 0, 2, 0, 0, 1}
+
+    tree := expectDiagnostics(t, source, nil)
+
+    for i, decl := range tree.Decls {
+        function := decl.(*FuncDecl)
+
+        if params := fieldList(function.Params); params != expected[i][0] {
+            t.Error("Expected parameters", expected[i][0], "for", function.Name.Name, "got", params)
+        }
+
+        if result := fieldList(function.Results); result != expected[i][1] {
+            t.Error("Expected results", expected[i][1], "for", function.Name.Name, "got", result)
+        }
+
+        if len(function.Body.List) > 0 {
+            if count := len(function.Body.List[0].(*ReturnStmt).Results); count != results[i] {
+                t.Error("Expected", results[i], "returned values in", function.Name.Name, "got", count)
+            }
+        }
+    }
+
+    errors := "package main\n" +
+        "func f(a int, []string) {\n}\n" +
+        "func g(a ...int, b int) {\n}\n" +
+        "func h() (...int) {\n}\n" +
+        "func i(a, b) (x int, y) {\n}\n" +
+        "func j(a ...int) {\n    j(a..., 1)\n}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:2:15: mixed named and unnamed parameters",
+        "t.go:4:10: can only use ... with final parameter in list",
+        "t.go:6:11: syntax error: unexpected ..., expecting type",
+        "t.go:8:23: syntax error: unexpected ), expecting type",
+        "t.go:11:13: syntax error: unexpected 1, expecting )",
+    })
+
+    spread := tree.Decls[7].(*FuncDecl).Body.List[0].(*ReturnStmt).Results[0].(*CallExpr)
+
+    if len(spread.Args) != 1 || spread.Ellipsis == 0 || source[spread.Ellipsis:spread.Ellipsis + 3] != "..." {
+        t.Error("Expected the call h(xs...) to spread its argument")
+    }
+
+    if recv := tree.Decls[6].(*FuncDecl).Recv; len(recv.Names) != 1 || recv.Names[0].Name != "any" {
+        t.Error("Expected the receiver any to shadow the predeclared type")
+    }
+}
+
+// bracket spells an expression with every binary and unary expression
+// wrapped in parentheses.
+func bracket(x Expr) string {
+    switch x := x.(type) {
+    case *BinaryExpr:
+        return "(" + bracket(x.X) + " " + operatorSpelling(x.Op) + " " + bracket(x.Y) + ")"
+    case *UnaryExpr:
+        return "(" + operatorSpelling(x.Op) + bracket(x.X) + ")"
+    case *CallExpr:
+        args := make([]string, len(x.Args))
+
+        for i, arg := range x.Args {
+            args[i] = bracket(arg)
+        }
+
+        return bracket(x.Fun) + "(" + strings.Join(args, ", ") + ")"
+    case *IndexExpr:
+        return bracket(x.X) + "[" + bracket(x.Index) + "]"
+    case *StarExpr:
+        return "(*" + bracket(x.X) + ")"
+    }
+
+    return nodeValue(x)
+}
+
+func TestMethods(t *testing.T) {
+    source := "package main\n" +
+        "func (c *counter) Inc() {\n    c.n++\n}\n" +
+        "type counter struct {\n    n int\n}\n" +
+        "func (c counter) Value() int {\n    return c.n\n}\n" +
+        "func (counter) Name() string {\n    return \"counter\"\n}\n" +
+        "func (*counter) Reset () {}\n" +
+        "func main () {\n    var c counter\n    (&c).Inc()\n    c.Value()\n}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    inc := tree.Decls[0].(*FuncDecl)
+
+    if inc.Recv == nil || inc.Recv.Names[0].Name != "c" || inc.Name.Name != "Inc" {
+        t.Fatal("Expected the method Inc with the receiver c")
+    }
+
+    if base, pointer := receiverBase(inc.Recv); base.Name != "counter" || !pointer {
+        t.Error("Expected a *counter receiver")
+    }
+
+    if name := tree.Decls[3].(*FuncDecl).Recv; len(name.Names) != 0 {
+        t.Error("Expected an unnamed receiver")
+    }
+
+    if main := tree.Decls[5].(*FuncDecl); main.Recv != nil || main.Name.Name != "main" {
+        t.Error("Expected main to be a function")
+    }
+
+    methods := func(pointer bool) string {
+        var names []string
+
+        for _, method := range tree.MethodSet("counter", pointer) {
+            names = append(names, method.Name.Name)
+        }
+
+        return strings.Join(names, " ")
+    }
+
+    if set := methods(false); set != "Value Name" {
+        t.Error("Expected the method set of counter to be Value Name got", set)
+    }
+
+    if set := methods(true); set != "Inc Value Name Reset" {
+        t.Error("Expected the method set of *counter to be Inc Value Name Reset got", set)
+    }
+
+    tree.Remove(tree.Decls[0])
+
+    if set := methods(true); set != "Value Name Reset" {
+        t.Error("Expected Inc to leave the method set when removed got", set)
+    }
+
+    errors := "package main\n" +
+        "func () None() {}\n" +
+        "func (a, b T) Three() {}\n" +
+        "func (s []int) Len() int {}\n" +
+        "func (T) Two() {}\n" +
+        "func (t *T) Two() {}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:2:6: method has no receiver",
+        "t.go:3:6: method has multiple receivers",
+        "t.go:4:9: invalid receiver type []int",
+        "t.go:6:13: method T.Two already declared at t.go:5:10",
+    })
+}
+
+func TestConstDeclarations(t *testing.T) {
+    source := "package main\n" +
+        "type Weekday int\n" +
+        "const (\n    Sunday Weekday = iota\n    Monday\n    Tuesday\n)\n" +
+        "const (\n    _  = iota\n    KB = 1 << (10 * iota)\n    MB\n)\n" +
+        "const a, b = 7 / 2, 7 / 2.0\n" +
+        "const c float64 = 'a' + 1\n" +
+        "const d = len(\"abc\") > 2 && !false\n" +
+        "var (\n    x, y int = 1, 2\n    z = x\n)\n" +
+        "func main() {\n    const e = Tuesday * 2\n    var f, g = 1, 2\n}\n" +
+        "var buf [4]byte\n" +
+        "type T struct {\n    a [2]int\n}\n" +
+        "const n, m = len(buf), len(T{}.a)\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    values := map[string]string{}
+
+    Inspect(tree, func(node Node) bool {
+        if declaration, ok := node.(*ConstDecl); ok {
+            for i, name := range declaration.Names {
+                if c := declaration.Constants[i]; c != nil {
+                    values[name.Name] = strings.TrimSpace(c.Type + " " + c.String())
+                }
+            }
+        }
+
+        return true
+    })
+
+    expected := map[string]string{
+        "Sunday":  "Weekday 0",
+        "Monday":  "Weekday 1",
+        "Tuesday": "Weekday 2",
+        "_":       "0",
+        "KB":      "1024",
+        "MB":      "1048576",
+        "a":       "3",
+        "b":       "3.5",
+        "c":       "float64 98",
+        "d":       "true",
+        "e":       "Weekday 4",
+    }
+
+    for name, value := range expected {
+        if values[name] != value {
+            t.Error("Expected", name, "to be", value, "got", values[name])
+        }
+    }
+
+    group := tree.Decls[1].(*DeclGroup)
+
+    if group.Tok != itemConst || len(group.Decls) != 3 {
+        t.Fatal("Expected a group of 3 const declarations")
+    }
+
+    if monday := group.Decls[1].(*ConstDecl); monday.Iota != 1 || len(monday.Values) != 0 || monday.Type != nil {
+        t.Error("Expected Monday to repeat the declaration before it")
+    }
+
+    if b := tree.Decls[3].(*ConstDecl).Constants[1]; b.Kind != constantFloat || b.Type != "" {
+        t.Error("Expected b to be an untyped float constant")
+    }
+
+    vars := tree.Decls[6].(*DeclGroup)
+
+    if first := vars.Decls[0].(*VarDecl); vars.Tok != itemVar || len(first.Names) != 2 || len(first.Values) != 2 {
+        t.Error("Expected a group of var declarations with x, y int = 1, 2")
+    }
+
+    if local := tree.Decls[7].(*FuncDecl).Body.List; nodeName(local[0]) != "ConstDecl" || len(local[1].(*VarDecl).Names) != 2 {
+        t.Error("Expected local const and var declarations")
+    }
+
+    // the length of an array is constant, its value is not known here
+    if lengths := tree.Decls[10].(*ConstDecl); lengths.Constants[0] != nil || lengths.Constants[1] != nil {
+        t.Error("Expected the lengths of arrays to be left unknown")
+    }
+
+    errors := "package main\n" +
+        "const (\n    a\n    b, c = 1\n    d = 1, 2\n)\n" +
+        "const e int8 = 1 << 7\n" +
+        "const f = 1 / 0\n" +
+        "const g [2]int = 1\n" +
+        "const (\n    h uint8 = 64 << iota\n    i\n    j\n)\n" +
+        "func main() {\n    var x, y = 1\n    const k = x\n}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:3:5: missing init expr for const declaration",
+        "t.go:4:8: missing init expr for const declaration",
+        "t.go:5:12: extra init expr",
+        "t.go:7:16: constant 128 overflows int8",
+        "t.go:8:11: invalid operation: division by zero",
+        "t.go:9:9: invalid constant type [2]int",
+        "t.go:13:5: constant 256 overflows uint8",
+        "t.go:16:9: assignment mismatch: 2 variables but 1 value",
+        "t.go:17:15: x is not constant",
+    })
+}
+
+func TestFunctionLiterals(t *testing.T) {
+    source := "package main\n" +
+        "var global = 1\n" +
+        "func apply(f func(int) int, x int) int {\n    return f(x)\n}\n" +
+        "func counter() func() int {\n" +
+        "    n := 0\n" +
+        "    const step = 1\n" +
+        "    return func() int {\n        n += step + global\n        return n\n    }\n" +
+        "}\n" +
+        "func main() {\n" +
+        "    var handler func(string, ...int) (int, error)\n" +
+        "    double := func(x int) int { return x * 2 }\n" +
+        "    total := 0\n" +
+        "    for i := 0; i < 3; i++ {\n" +
+        "        func() {\n" +
+        "            total += apply(double, i)\n" +
+        "            inner := func(y int) int { return y + total }\n" +
+        "            _ = inner\n" +
+        "        }()\n" +
+        "    }\n" +
+        "    _ = handler\n" +
+        "    func() {\n" +
+        "        _ = map[int]bool{double: true}\n" +
+        "        _ = []map[int]bool{{total: true}}\n" +
+        "        total := 2\n" +
+        "        p := P{total: total}\n" +
+        "        for handler := 0; handler < p.total; handler++ {\n" +
+        "        }\n" +
+        "    }()\n" +
+        "}\n" +
+        "type P struct {\n    total int\n}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    if f, ok := tree.Decls[1].(*FuncDecl).Params[0].Type.(*FuncType); !ok || len(f.Params) != 1 || len(f.Results) != 1 {
+        t.Error("Expected the parameter f to have the type func(int) int")
+    }
+
+    var literals []*FuncLit
+
+    Inspect(tree, func(node Node) bool {
+        if literal, ok := node.(*FuncLit); ok {
+            literals = append(literals, literal)
+        }
+
+        return true
+    })
+
+    free := func(literal *FuncLit) string {
+        var names []string
+
+        for _, name := range literal.Free {
+            names = append(names, name.Name)
+        }
+
+        return strings.Join(names, " ")
+    }
+
+    // a shadowing declaration, a field name and a loop variable are not
+    // captured, a map key is, also in a literal that leaves out its type
+    expected := []string{"n", "", "total double i", "total", "double total"}
+
+    if len(literals) != len(expected) {
+        t.Fatal("Expected", len(expected), "function literals got", len(literals))
+    }
+
+    for i, literal := range literals {
+        if names := free(literal); names != expected[i] {
+            t.Error("Expected the free variables", expected[i], "got", names)
+        }
+    }
+
+    // the captured n is the one declared by n := 0
+    declared := tree.Decls[2].(*FuncDecl).Body.List[0].(*AssignStmt).Lhs[0]
+
+    if literals[0].Free[0] != declared {
+        t.Error("Expected the free variable n to be its declaration")
+    }
+
+    if tree.Parent(declared) == Node(literals[0]) {
+        t.Error("Expected a free variable to stay in its declaration")
+    }
+
+    handler := tree.Decls[3].(*FuncDecl).Body.List[0].(*VarDecl).Type.(*FuncType)
+
+    if _, ok := handler.Params[1].Type.(*Ellipsis); !ok || len(handler.Results) != 2 {
+        t.Error("Expected the type func(string, ...int) (int, error)")
+    }
+
+    errors := "package main\n" +
+        "func main() {\n" +
+        "outer:\n" +
+        "    for {\n" +
+        "        func() {\n" +
+        "            break\n" +
+        "        }()\n" +
+        "        f := func() {\n" +
+        "            continue outer\n" +
+        "        }\n" +
+        "        f()\n" +
+        "        break outer\n" +
+        "    }\n" +
+        "}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:6:13: break is not in a loop, switch, or select",
+        "t.go:9:22: label outer not defined",
+    })
+}
+
+func TestInterfaces(t *testing.T) {
+    source := "package main\n" +
+        "type Shape interface {\n    Area() float64\n    Scale(f float64) Shape\n}\n" +
+        "type Named interface {\n    Shape\n    Name() string\n}\n" +
+        "type Number interface {\n    ~int | ~float64\n    String() string\n}\n" +
+        "type Meters float64\n" +
+        "func (m Meters) String() string { return \"m\" }\n" +
+        "type Square struct {\n    side float64\n}\n" +
+        "func (s Square) Area() float64 { return s.side * s.side }\n" +
+        "func (s *Square) Scale(f float64) Shape { return s }\n" +
+        "var _ Shape = (*Square)(nil)\n" +
+        "func main() {\n" +
+        "    var s interface{} = Square{}\n" +
+        "    square, ok := s.(Square)\n" +
+        "    _, _ = square, ok\n" +
+        "}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    shape := tree.typeDecl("Shape").Type.(*InterfaceType)
+
+    if len(shape.Methods) != 2 || shape.Methods[1].Names[0].Name != "Scale" {
+        t.Fatal("Expected the methods Area and Scale")
+    }
+
+    if signature := typeString(shape.Methods[1].Type); signature != "func(float64) Shape" {
+        t.Error("Expected the signature func(float64) Shape got", signature)
+    }
+
+    named := tree.typeDecl("Named").Type.(*InterfaceType)
+
+    if embedded := named.Methods[0]; len(embedded.Names) != 0 || embedded.Type.(*Ident).Name != "Shape" {
+        t.Error("Expected Named to embed Shape")
+    }
+
+    number := tree.typeDecl("Number").Type.(*InterfaceType)
+
+    if union := typeString(number.Methods[0].Type); union != "~int | ~float64" || !tree.isConstraint(number) {
+        t.Error("Expected the constraint ~int | ~float64 got", union)
+    }
+
+    implementations := []struct {
+        name    string
+        pointer bool
+        iface   *InterfaceType
+        reason  string
+    }{
+        {"Square", true, shape, ""},
+        {"Square", false, shape, "method Scale has pointer receiver"},
+        {"Square", true, named, "missing method Name"},
+        {"Meters", false, number, ""},
+        {"Meters", true, number, "*Meters missing in ~int | ~float64"},
+        {"Square", false, number, "Square missing in ~int | ~float64"},
+    }
+
+    for _, implementation := range implementations {
+        implements, reason := tree.Implements(implementation.name, implementation.pointer, implementation.iface)
+
+        if implements != (implementation.reason == "") || reason != implementation.reason {
+            t.Error("Expected", implementation.name, "to be implemented with", implementation.reason, "got", reason)
+        }
+    }
+
+    assignment := tree.Decls[9].(*FuncDecl).Body.List[1].(*AssignStmt)
+
+    if assertion, ok := assignment.Rhs[0].(*TypeAssertExpr); !ok || assertion.Type.(*Ident).Name != "Square" {
+        t.Error("Expected the type assertion s.(Square)")
+    }
+
+    errors := "package main\n" +
+        "type Closer interface {\n    Close() error\n    Close() error\n}\n" +
+        "type Number interface {\n    int | float64\n}\n" +
+        "type File struct{}\n" +
+        "func (f File) Close() {}\n" +
+        "var _ Closer = File{}\n" +
+        "var _ Number = 1\n" +
+        "func main() {\n    var x interface{}\n    a, b, c := x.(File)\n}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:4:5: duplicate method Close",
+        "t.go:11:16: cannot use File{} (value of type File) as Closer value in variable declaration: File does not implement Closer (wrong type for method Close)",
+        "t.go:12:7: cannot use type Number outside a type constraint: interface contains type constraints",
+        "t.go:15:5: assignment mismatch: 3 variables but 1 value",
+    })
+}
+
+func TestDeferStatements(t *testing.T) {
+    source := "package main\n" +
+        "func safe(f func()) (err error) {\n" +
+        "    defer func() {\n" +
+        "        if r := recover(); r != nil {\n" +
+        "            err = r.(error)\n" +
+        "        }\n" +
+        "    }()\n" +
+        "    defer fmt.Println(\"done\")\n" +
+        "    defer close(c)\n" +
+        "    f()\n" +
+        "    panic(\"unreachable\")\n" +
+        "}\n"
+
+    tree := expectDiagnostics(t, source, nil)
+
+    list := tree.Decls[0].(*FuncDecl).Body.List
+
+    if deferred, ok := list[0].(*DeferStmt); !ok || nodeName(deferred.Call.Fun) != "FuncLit" {
+        t.Error("Expected the deferred call of a function literal")
+    }
+
+    if deferred, ok := list[1].(*DeferStmt); !ok || nodeName(deferred.Call.Fun) != "SelectorExpr" {
+        t.Error("Expected the deferred call fmt.Println")
+    }
+
+    if literal := list[0].(*DeferStmt).Call.Fun.(*FuncLit); len(literal.Free) != 1 || literal.Free[0].Name != "err" {
+        t.Error("Expected the deferred function literal to capture err")
+    }
+
+    errors := "package main\n" +
+        "func main() {\n" +
+        "    defer x\n" +
+        "    defer len(s)\n" +
+        "    defer int(1)\n" +
+        "    defer recover(1)\n" +
+        "    panic()\n" +
+        "    defer (f())\n" +
+        "    defer (f)()\n" +
+        "    func() {\n        recover()\n    }()\n" +
+        "    defer func() {\n        func() {\n            recover()\n        }()\n    }()\n" +
+        "    handler := func() {\n        recover()\n    }\n" +
+        "    defer handler()\n" +
+        "    defer recover()\n" +
+        "}\n" +
+        "func shadowed(len func(string) int) {\n    defer len(\"x\")\n}\n" +
+        "func f() {}\n"
+    expectDiagnostics(t, errors, []string{
+        "t.go:3:11: expression in defer must be function call",
+        "t.go:4:11: defer discards result of len(s)",
+        "t.go:5:11: defer requires function call, not conversion",
+        "t.go:6:11: too many arguments for recover(1) (expected 0, found 1)",
+        "t.go:7:5: not enough arguments for panic() (expected 1, found 0)",
+        "t.go:8:11: expression in defer must not be parenthesized",
+    })
+}
+
+func TestCRLFLineEndings(t *testing.T) {
+    source := "package main // crlf\n" +
+        "func main() {\n" +
+        "    s := `a\nb`\n" +
+        "    if s != \"\" {\n        s += \"c\"\n    }\n" +
+        "    println(\n        s,\n        []int{\n            1,\n        },\n    )\n" +
+        "}\n"
+
+    tree := expectDiagnostics(t, strings.Replace(source, "\n", "\r\n", -1), nil)
+
+    if tree.Package.Name != "main" {
+        t.Error("Expected the package main got", tree.Package.Name)
+    }
+
+    body := tree.Decls[0].(*FuncDecl).Body.List
+
+    if len(body) != 3 {
+        t.Fatal("Expected 3 statements got", len(body))
+    }
+
+    if call := body[2].(*ExprStmt).X.(*CallExpr); len(call.Args) != 2 {
+        t.Error("Expected 2 arguments in the call spanning lines got", len(call.Args))
+    }
+
+    if raw := body[0].(*AssignStmt).Rhs[0].(*BasicLit).Value; raw != "a\nb" {
+        t.Errorf("Expected the raw string without carriage returns got %q", raw)
+    }
+}
+
+func TestPrecedence(t *testing.T) {
+    pairs := [][2]string{
+        {"a + b * c", "(a + (b * c))"},
+        {"a - b - c", "((a - b) - c)"},
+        {"(a + b) * c", "((a + b) * c)"},
+        {"a || b && c == d + e * f", "(a || (b && (c == (d + (e * f)))))"},
+        {"a << 2 | b &^ c", "((a << 2) | (b &^ c))"},
+        {"!x == y", "((!x) == y)"},
+        {"-a * -(b + c)", "((-a) * (-(b + c)))"},
+        {"a < b == c > d", "(((a < b) == c) > d)"},
+        {"f(a + b, (c))[i % 2] ^ 1", "(f((a + b), c)[(i % 2)] ^ 1)"},
+        {"a * *p * b", "((a * (*p)) * b)"},
+        {"&x == *q && -*r < 0", "(((&x) == (*q)) && ((-(*r)) < 0))"},
+    }
+
+    for _, pair := range pairs {
+        p := &parser{lex: newLexer("t.go", pair[0])}
+        x, token := parseExpression(getNextToken(p), p)
+
+        // the lexer ends the expression with an automatic semicolon
+        if token.typ != itemSemiColon {
+            t.Error("Expected the whole of", pair[0], "to be read, stopped at", token.val)
+        }
+
+        if got := bracket(x); got != pair[1] {
+            t.Error("Expected", pair[1], "got", got)
+        }
+    }
+}
@@ -0,0 +1,46 @@
+package main
+
+// scope is a block of the program with the names declared directly in it.
+type scope struct {
+	outer *scope
+	names map[string]*Ident
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, names: map[string]*Ident{}}
+}
+
+// declare adds name to the scope. The blank identifier is never declared.
+func (s *scope) declare(name *Ident) {
+	if name.Name != "_" {
+		s.names[name.Name] = name
+	}
+}
+
+// lookupLocal returns the declaration of name in this block only.
+func (s *scope) lookupLocal(name string) *Ident {
+	return s.names[name]
+}
+
+// lookup returns the innermost declaration of name visible from this block,
+// or nil.
+func (s *scope) lookup(name string) *Ident {
+	for ; s != nil; s = s.outer {
+		if declaration, ok := s.names[name]; ok {
+			return declaration
+		}
+	}
+
+	return nil
+}
+
+// within reports whether s is outer or a block nested in it.
+func (s *scope) within(outer *scope) bool {
+	for ; s != nil; s = s.outer {
+		if s == outer {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,63 @@
+package main
+
+type predeclaredKind int
+
+const (
+	predeclaredType predeclaredKind = iota + 1
+	predeclaredConstant
+	predeclaredZero
+	predeclaredFunction
+)
+
+// predeclared holds the identifiers that are implicitly declared in the
+// universe block. They are ordinary identifiers for the lexer and may be
+// shadowed by declarations of the program.
+var predeclared = map[string]predeclaredKind{
+	"any":        predeclaredType,
+	"bool":       predeclaredType,
+	"byte":       predeclaredType,
+	"comparable": predeclaredType,
+	"complex64":  predeclaredType,
+	"complex128": predeclaredType,
+	"error":      predeclaredType,
+	"float32":    predeclaredType,
+	"float64":    predeclaredType,
+	"int":        predeclaredType,
+	"int8":       predeclaredType,
+	"int16":      predeclaredType,
+	"int32":      predeclaredType,
+	"int64":      predeclaredType,
+	"rune":       predeclaredType,
+	"string":     predeclaredType,
+	"uint":       predeclaredType,
+	"uint8":      predeclaredType,
+	"uint16":     predeclaredType,
+	"uint32":     predeclaredType,
+	"uint64":     predeclaredType,
+	"uintptr":    predeclaredType,
+
+	"true":  predeclaredConstant,
+	"false": predeclaredConstant,
+	"iota":  predeclaredConstant,
+
+	"nil": predeclaredZero,
+
+	"append":  predeclaredFunction,
+	"cap":     predeclaredFunction,
+	"clear":   predeclaredFunction,
+	"close":   predeclaredFunction,
+	"complex": predeclaredFunction,
+	"copy":    predeclaredFunction,
+	"delete":  predeclaredFunction,
+	"imag":    predeclaredFunction,
+	"len":     predeclaredFunction,
+	"make":    predeclaredFunction,
+	"max":     predeclaredFunction,
+	"min":     predeclaredFunction,
+	"new":     predeclaredFunction,
+	"panic":   predeclaredFunction,
+	"print":   predeclaredFunction,
+	"println": predeclaredFunction,
+	"real":    predeclaredFunction,
+	"recover": predeclaredFunction,
+}